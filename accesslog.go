@@ -0,0 +1,237 @@
+package hook
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default config for access log middleware
+const (
+	DefaultRequestIDHeader = "X-Request-Id"
+)
+
+// AccessLogOptions configures the access log middleware. Access logs go to the
+// logstore & topic of the producer, so create a dedicated producer to route them
+// to their own logstore & topic.
+type AccessLogOptions struct {
+	// TrustedProxies are ips or cidrs of proxies whose X-Forwarded-For &
+	// X-Real-Ip headers are trusted for the remote ip
+	TrustedProxies []string
+	// RequestIDHeader is read for the request id, which is generated and set on
+	// both the request and response when missing. Defaults to DefaultRequestIDHeader.
+	RequestIDHeader string
+}
+
+// AccessLog creates a net/http middleware sending one log per request through the producer
+func (p *Producer) AccessLog(opts *AccessLogOptions) (func(http.Handler) http.Handler, error) {
+	if opts == nil {
+		opts = &AccessLogOptions{}
+	}
+	requestIDHeader := opts.RequestIDHeader
+	if len(requestIDHeader) == 0 {
+		requestIDHeader = DefaultRequestIDHeader
+	}
+	proxies, err := parseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestID := r.Header.Get(requestIDHeader)
+			if len(requestID) == 0 {
+				requestID = newRequestID()
+				r.Header.Set(requestIDHeader, requestID)
+			}
+			w.Header().Set(requestIDHeader, requestID)
+			recorder := &responseRecorder{ResponseWriter: w}
+			panicked := true
+			defer func() {
+				if panicked {
+					// The request failed whatever was written, net/http aborts the response.
+					// The panic propagates as it is, with its original stack.
+					recorder.status = http.StatusInternalServerError
+				}
+				p.sendAccessLog(r, recorder, start, requestID, proxies, panicked)
+			}()
+			next.ServeHTTP(recorder, r)
+			panicked = false
+		})
+	}, nil
+}
+
+// sendAccessLog sends the log of a request, with the stack of the handler if it panicked
+func (p *Producer) sendAccessLog(r *http.Request, recorder *responseRecorder, start time.Time, requestID string, proxies []*net.IPNet, panicked bool) {
+	status := recorder.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	log := acquireLog(uint32(start.Unix()))
+	level := "INFO"
+	if status >= 500 {
+		level = "ERROR"
+	} else if status >= 400 {
+		level = "WARNING"
+	}
+	appendContent(log, "level", level)
+	appendContent(log, "message", r.Method+" "+r.URL.Path+" "+strconv.Itoa(status))
+	appendContent(log, "method", r.Method)
+	appendContent(log, "host", r.Host)
+	appendContent(log, "path", r.URL.Path)
+	if len(r.URL.RawQuery) > 0 {
+		appendContent(log, "query", r.URL.RawQuery)
+	}
+	appendContent(log, "proto", r.Proto)
+	appendContent(log, "status", strconv.Itoa(status))
+	appendContent(log, "bytes", strconv.FormatInt(recorder.bytes, 10))
+	appendContent(log, "latency_ms", strconv.FormatFloat(float64(time.Since(start))/float64(time.Millisecond), 'f', 3, 64))
+	appendContent(log, "remote_ip", remoteIP(r, proxies))
+	if userAgent := r.UserAgent(); len(userAgent) > 0 {
+		appendContent(log, "user_agent", userAgent)
+	}
+	if referer := r.Referer(); len(referer) > 0 {
+		appendContent(log, "referer", referer)
+	}
+	appendContent(log, "request_id", requestID)
+	if panicked {
+		appendContent(log, "stack", string(debug.Stack()))
+	}
+	traceContext, ok := extractTrace(r.Context(), p.traceExtractors)
+	if !ok {
+		traceContext, ok = ParseTraceparent(r.Header.Get("traceparent"))
+	}
+	if ok {
+		appendTrace(log, traceContext)
+	}
+	_ = p.send(context.Background(), log)
+}
+
+// responseRecorder records the status & body size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Response writer does not support hijacking")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.Errorf("Invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "Invalid trusted proxy %q", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func isTrusted(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP resolves the client ip, trusting forwarding headers only when set by trusted proxies
+func remoteIP(r *http.Request, proxies []*net.IPNet) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !isTrusted(ip, proxies) {
+		return ip
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		// The rightmost untrusted hop is the client, the rest may be spoofed
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if len(hop) == 0 {
+				continue
+			}
+			ip = hop
+			if !isTrusted(hop, proxies) {
+				return hop
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); len(realIP) > 0 {
+		return realIP
+	}
+	return ip
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
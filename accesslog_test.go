@@ -0,0 +1,115 @@
+package hook_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	_, err := producer.AccessLog(&hook.AccessLogOptions{TrustedProxies: []string{"not an ip"}})
+	assert.NotNil(t, err)
+
+	middleware, err := producer.AccessLog(&hook.AccessLogOptions{TrustedProxies: []string{"192.0.2.1", "10.0.0.0/8"}})
+	assert.Nil(t, err)
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("Hello world!"))
+	}))
+
+	req := httptest.NewRequest("GET", "/hello?name=world", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7, 203.0.113.9, 10.1.2.3")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, "req-1", recorder.Header().Get("X-Request-Id"))
+
+	// Forwarding headers from untrusted peers are ignored
+	req = httptest.NewRequest("POST", "/missing", nil)
+	req.RemoteAddr = "198.51.100.1:4321"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	requestID := recorder.Header().Get("X-Request-Id")
+	assert.Equal(t, 32, len(requestID))
+	assert.Nil(t, producer.FlushContext(context.Background()))
+
+	// The WARNING log is sent first
+	logs := receiveLogs(t, server, 2)
+	assert.Equal(t, "INFO", logs[1]["level"])
+	assert.Equal(t, "GET /hello 200", logs[1]["message"])
+	assert.Equal(t, "GET", logs[1]["method"])
+	assert.Equal(t, "/hello", logs[1]["path"])
+	assert.Equal(t, "name=world", logs[1]["query"])
+	assert.Equal(t, "200", logs[1]["status"])
+	assert.Equal(t, "12", logs[1]["bytes"])
+	assert.Contains(t, logs[1], "latency_ms")
+	assert.Equal(t, "203.0.113.9", logs[1]["remote_ip"])
+	assert.Equal(t, "test-agent", logs[1]["user_agent"])
+	assert.Equal(t, "req-1", logs[1]["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logs[1]["trace_id"])
+
+	assert.Equal(t, "WARNING", logs[0]["level"])
+	assert.Equal(t, "404", logs[0]["status"])
+	assert.Equal(t, "198.51.100.1", logs[0]["remote_ip"])
+	assert.Equal(t, requestID, logs[0]["request_id"])
+}
+
+func TestAccessLogPanic(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	middleware, err := producer.AccessLog(nil)
+	assert.Nil(t, err)
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	assert.PanicsWithValue(t, "boom", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+	assert.Nil(t, producer.FlushContext(context.Background()))
+
+	logs := receiveLogs(t, server, 1)
+	assert.Equal(t, "ERROR", logs[0]["level"])
+	assert.Equal(t, "GET /panic 500", logs[0]["message"])
+	assert.Equal(t, "500", logs[0]["status"])
+	assert.Contains(t, logs[0]["stack"], "TestAccessLogPanic.func1(")
+}
+
+func TestAccessLogDedicatedProducer(t *testing.T) {
+	server := newServer(t)
+	appProducer, err := hook.NewProducer(append(server.Options(), hook.WithLogStore("app"), hook.WithTopic("app"))...)
+	assert.Nil(t, err)
+	accessLogProducer, err := hook.NewProducer(append(server.Options(), hook.WithLogStore("access-log"), hook.WithTopic("api"))...)
+	assert.Nil(t, err)
+
+	accessLog, err := accessLogProducer.AccessLog(nil)
+	assert.Nil(t, err)
+	handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, appProducer.SendMap(time.Now(), map[string]string{"message": "handled"}))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+	assert.Nil(t, appProducer.FlushContext(context.Background()))
+	assert.Nil(t, accessLogProducer.FlushContext(context.Background()))
+
+	routes := make(map[string]string)
+	for _, received := range server.Received() {
+		message, _ := slstest.Value(received.Group.Logs[0], "message")
+		routes[message] = received.LogStore + "/" + received.Group.GetTopic()
+	}
+	assert.Equal(t, map[string]string{"handled": "app/app", "GET /hello 200": "access-log/api"}, routes)
+}
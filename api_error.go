@@ -0,0 +1,66 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// APIError is an error response from sls api
+type APIError struct {
+	StatusCode int
+	Code       string `json:"errorCode"`
+	Message    string `json:"errorMessage"`
+	RequestID  string
+}
+
+func (e *APIError) Error() string {
+	if len(e.Code) == 0 {
+		return fmt.Sprintf("Sls api error %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Sls api error %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Retryable reports whether the request may succeed when retried
+func (e *APIError) Retryable() bool {
+	switch e.Code {
+	case "WriteQuotaExceed", "ShardWriteQuotaExceed", "ServerBusy", "InternalServerError", "RequestTimeout":
+		return true
+	case "RequestTimeExpired":
+		// Signed again with the clock offset detected from the response
+		return true
+	}
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+func newAPIError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	apiError := &APIError{}
+	if json.Unmarshal(body, apiError) != nil || len(apiError.Code) == 0 {
+		apiError.Code = ""
+		apiError.Message = string(body)
+	}
+	apiError.StatusCode = resp.StatusCode
+	apiError.RequestID = resp.Header.Get(HeaderLogRequestID)
+	return apiError
+}
+
+// isRetryable reports whether a failed send should be retried
+func isRetryable(err error) bool {
+	cause := errors.Cause(err)
+	if cause == context.Canceled || cause == context.DeadlineExceeded {
+		return false
+	}
+	if apiError, ok := cause.(*APIError); ok {
+		return apiError.Retryable()
+	}
+	// Connection errors
+	return true
+}
@@ -0,0 +1,120 @@
+package hook
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default config for the circuit breaker around sends
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// BreakerState of the circuit breaker around sends
+type BreakerState int
+
+// Breaker states
+const (
+	// BreakerClosed sends every batch
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails fast to the fallback until the cooldown elapses
+	BreakerOpen
+	// BreakerHalfOpen probes with a single batch
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// breaker opens after threshold consecutive failed sends, probing again after cooldown
+type breaker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: orDefault(threshold, DefaultBreakerThreshold),
+		cooldown:  orDefaultDuration(cooldown, DefaultBreakerCooldown),
+	}
+}
+
+// allow reports whether a batch may be sent, a single probe is allowed once the cooldown elapses
+func (b *breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// done records the result of an allowed send, returning true when the breaker opens
+func (b *breaker) done(failed bool) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		return false
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		opened := b.state == BreakerClosed
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.probing = false
+		return opened
+	}
+	return false
+}
+
+func (b *breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+// breakerFailure tells whether a failed send means sls is not available
+func breakerFailure(err error) bool {
+	cause := errors.Cause(err)
+	if cause == context.Canceled {
+		return false
+	}
+	if apiError, ok := cause.(*APIError); ok {
+		return apiError.Retryable()
+	}
+	// Connection errors & timeouts
+	return true
+}
@@ -0,0 +1,56 @@
+package hook_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	server := newServer(t)
+	server.Inject(slstest.InternalError(), 0)
+	var posts, fallbacks int32
+	producer := newTestProducer(t, server,
+		hook.WithTransport(interceptPosts(func(req *http.Request) {
+			atomic.AddInt32(&posts, 1)
+		})),
+		hook.WithMaxRetries(-1),
+		hook.WithCircuitBreaker(2, 50*time.Millisecond),
+		hook.WithFallback(func(_ context.Context, logs []*hook.Log) error {
+			atomic.AddInt32(&fallbacks, 1)
+			return nil
+		}),
+	)
+	send := func() {
+		assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"message": "breaker"}))
+		assert.Nil(t, producer.FlushContext(context.Background()))
+	}
+
+	send()
+	assert.Equal(t, hook.BreakerClosed, producer.BreakerState())
+	send()
+	assert.Equal(t, hook.BreakerOpen, producer.BreakerState())
+	// Fails fast while open
+	send()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&posts))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fallbacks))
+
+	// A failed probe opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	send()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&posts))
+	assert.Equal(t, hook.BreakerOpen, producer.BreakerState())
+
+	server.ClearFaults()
+	time.Sleep(60 * time.Millisecond)
+	send()
+	assert.Equal(t, int32(4), atomic.LoadInt32(&posts))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&fallbacks))
+	assert.Equal(t, hook.BreakerClosed, producer.BreakerState())
+}
@@ -1,14 +1,16 @@
 package hook
 
 import (
-	"bytes"
+	"context"
 	"crypto/md5"
 	"fmt"
-	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -21,6 +23,10 @@ const (
 	MaxLogItemSize  = 512 * 1024      // Safe value for maximum 1M log item.
 	MaxLogGroupSize = 4 * 1024 * 1024 // Safe value for maximum 5M log group
 	MaxLogBatchSize = 1024            // Safe value for batch send size
+
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 100 * time.Millisecond
+	MaxRetryBackoff     = 2 * time.Second
 )
 
 var logSource string
@@ -35,18 +41,27 @@ func init() {
 
 // SlsClient the client struct for sls connection
 type SlsClient struct {
-	endpoint     string
-	accessKey    string
-	accessSecret string
-	logStore     string
-	topic        string
-	lock         *sync.Mutex
-	client       *http.Client
+	endpoints      []*endpoint
+	probeInterval  time.Duration
+	timeout        time.Duration
+	probing        bool
+	clockOffset    atomic.Int64
+	bytesLimiter   *limiter
+	requestLimiter *limiter
+	accessKey      string
+	accessSecret   string
+	logStore       string
+	topic          string
+	oversizePolicy OversizePolicy
+	compression    Compression
+	maxRetries     int
+	lock           *sync.Mutex
+	client         *http.Client
 }
 
 // NewSlsClient create a new sls client
 func NewSlsClient(config *Config) (*SlsClient, error) {
-	if len(config.Endpoint) == 0 {
+	if len(config.Endpoint) == 0 && len(config.Endpoints) == 0 {
 		return nil, errors.New("Sls endpoint should not be empty")
 	}
 	if len(config.AccessKey) == 0 {
@@ -58,154 +73,205 @@ func NewSlsClient(config *Config) (*SlsClient, error) {
 	if len(config.LogStore) == 0 {
 		return nil, errors.New("Sls log store should not be empty")
 	}
-	endpoint := config.Endpoint
-	if !strings.HasPrefix(endpoint, "http://") || !strings.HasPrefix(endpoint, "https://") {
-		endpoint = "http://" + endpoint
+	endpoints, err := parseEndpoints(config)
+	if err != nil {
+		return nil, err
+	}
+	maxRetries := config.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	} else if maxRetries < 0 {
+		maxRetries = 0
 	}
-	if strings.HasSuffix(endpoint, "/") {
-		endpoint = endpoint[:len(endpoint)-1]
+	httpClient, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
 	}
 	return &SlsClient{
-		endpoint:     endpoint,
-		accessKey:    config.AccessKey,
-		accessSecret: config.AccessSecret,
-		logStore:     config.LogStore,
-		topic:        config.Topic,
-		lock:         &sync.Mutex{},
-		client: &http.Client{
-			Timeout: config.Timeout,
-		},
+		endpoints:      endpoints,
+		probeInterval:  orDefaultDuration(config.EndpointProbeInterval, DefaultEndpointProbeInterval),
+		timeout:        orDefaultDuration(config.Timeout, DefaultTimeout),
+		accessKey:      config.AccessKey,
+		accessSecret:   config.AccessSecret,
+		logStore:       config.LogStore,
+		topic:          config.Topic,
+		oversizePolicy: config.OversizePolicy,
+		compression:    config.Compression,
+		maxRetries:     maxRetries,
+		lock:           &sync.Mutex{},
+		client:         httpClient,
+		bytesLimiter:   newLimiter(config.RateLimitBytes),
+		requestLimiter: newLimiter(config.RateLimitRequests),
 	}, nil
 }
 
 // Ping sls api auth & connection
 func (client *SlsClient) Ping() error {
+	return client.PingContext(context.Background())
+}
+
+// PingContext sls api auth & connection, aborting when ctx is done.
+// Endpoints are tried in order until one is reachable.
+func (client *SlsClient) PingContext(ctx context.Context) error {
+	resp, _, err := client.do(ctx, client.pingRequest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	client.observeDate(resp)
+	if resp.StatusCode != 200 {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+// pingRequest builds a request getting the log store from e
+func (client *SlsClient) pingRequest(ctx context.Context, e *endpoint) (*http.Request, error) {
 	method := "GET"
 	resource := "/logstores/" + client.logStore
 	headers := make(map[string]string)
 
 	headers[HeaderLogVersion] = SlsVersion
 	headers[HeaderLogSignatureMethod] = SlsSignatureMethod
-	headers[HeaderHost] = client.endpoint
-	headers[HeaderDate] = time.Now().UTC().Format(http.TimeFormat)
+	headers[HeaderDate] = client.now().UTC().Format(http.TimeFormat)
 
 	sign := APISign(client.accessSecret, method, headers, resource)
 	headers[HeaderAuthorization] = fmt.Sprintf("LOG %s:%s", client.accessKey, sign)
 
-	url := client.endpoint + resource
+	url := e.url + resource
 
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
-		return errors.WithMessage(err, "Error creating http request for sls")
+		return nil, errors.WithMessage(err, "Error creating http request for sls")
 	}
+	req.Host = e.host
 	for header, value := range headers {
 		req.Header.Add(header, value)
 	}
-
-	resp, err := client.client.Do(req)
-	defer func() {
-		if resp != nil {
-			_ = resp.Body.Close()
-		}
-	}()
-	if err != nil {
-		return errors.WithMessage(err, "Error sending log with http client")
-	}
-	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		return errors.New(string(body))
-	}
-	return nil
+	return req, nil
 }
 
 // SendLogs using sls api & handle extreme cases
 func (client *SlsClient) SendLogs(logs []*Log) error {
+	return client.SendLogsContext(context.Background(), logs)
+}
+
+// SendLogsContext using sls api & handle extreme cases, aborting when ctx is done
+func (client *SlsClient) SendLogsContext(ctx context.Context, logs []*Log) error {
 	if len(logs) == 0 {
 		return nil
 	}
 	if len(logs) > MaxLogBatchSize {
 		return errors.Errorf("Log batch size should not exceed %d.", MaxLogBatchSize)
 	}
-	group := LogGroup{}
-	group.Logs = logs
-	group.Topic = proto.String(client.topic)
-	group.Source = proto.String(logSource)
-	body, err := proto.Marshal(&group)
-	if len(body) > MaxLogGroupSize {
-		// Extreme cases when log group size exceed the maximum
-		return client.splitSendLogs(logs)
-	}
-	if err != nil {
-		return err
-	}
-	err = client.sendPb(body)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func logSize(log *Log) int {
-	// Estimate log size
-	size := 4
-	for _, content := range log.Contents {
-		size += len(*content.Key) + len(*content.Value) + 8
-	}
-	return size
-}
-
-func (client *SlsClient) splitSendLogs(logs []*Log) error {
 	var errorList []error
-	cursor := 0
-	for cursor < len(logs) {
-		groupSize := 0
-		group := LogGroup{
-			Logs: make([]*Log, 0),
+	group := LogGroup{
+		Logs:   make([]*Log, 0, len(logs)),
+		Topic:  proto.String(client.topic),
+		Source: proto.String(logSource),
+	}
+	// Exact encoded sizes are accounted incrementally, so that each group is marshalled once.
+	baseSize := group.Size()
+	groupSize := baseSize
+	send := func() {
+		if len(group.Logs) == 0 {
+			return
 		}
-		group.Topic = proto.String(client.topic)
-		group.Source = proto.String(logSource)
-		for cursor < len(logs) {
-			log := logs[cursor]
-			size := logSize(log)
-			if groupSize+size > MaxLogGroupSize {
-				break
-			}
-			cursor++
-			if size > MaxLogItemSize {
-				// Print huge single log to stdout
-				_, _ = fmt.Fprintf(os.Stdout, "[HUGE SLS LOG] %+v", log)
-				continue
-			}
-			groupSize += size
-			group.Logs = append(group.Logs, log)
+		if err := client.sendGroup(ctx, &group, groupSize); err != nil {
+			errorList = append(errorList, err)
 		}
-
-		body, err := proto.Marshal(&group)
-		if len(body) > MaxLogGroupSize {
+		group.Logs = group.Logs[:0]
+		groupSize = baseSize
+	}
+	add := func(log *Log, size int) {
+		size += 1 + sovLog(uint64(size))
+		if groupSize+size > MaxLogGroupSize || len(group.Logs) >= MaxLogBatchSize {
 			// Extreme cases when log group size exceed the maximum
-			_, _ = fmt.Fprintf(os.Stdout, "[HUGE SLS LOG GROUP] %+v", group)
-			continue
+			send()
 		}
-		if err != nil {
-			errorList = append(errorList, err)
+		group.Logs = append(group.Logs, log)
+		groupSize += size
+	}
+	for _, log := range logs {
+		size := log.Size()
+		if size <= MaxLogItemSize {
+			add(log, size)
 			continue
 		}
-		err = client.sendPb(body)
-		if err != nil {
-			errorList = append(errorList, err)
-			continue
+		for _, fitted := range fitLog(log, client.oversizePolicy) {
+			add(fitted, fitted.Size())
 		}
 	}
+	send()
 	if len(errorList) == 0 {
 		return nil
 	}
+	if len(errorList) == 1 {
+		return errorList[0]
+	}
 	return errors.Errorf("Fail to send logs due to the following errors: %+v", errorList)
 }
 
-func (client *SlsClient) sendPb(logContent []byte) error {
+func (client *SlsClient) sendGroup(ctx context.Context, group *LogGroup, size int) error {
+	buf := acquireBuffer(size)
+	defer releaseBuffer(buf)
+	n, err := group.MarshalTo(*buf)
+	if err != nil {
+		return err
+	}
+	body := (*buf)[:n]
+	rawSize, compression := 0, CompressNone
+	compressed, err := compress(client.compression, body)
+	if err != nil {
+		return errors.WithMessage(err, "Error compressing log group")
+	}
+	if compressed != nil {
+		defer releaseBuffer(compressed)
+		body, rawSize, compression = *compressed, n, client.compression
+	}
+	replay := isReplay(ctx)
+	for attempt := 0; ; attempt++ {
+		if err = client.limit(ctx, len(body), !replay && attempt == 0); err != nil {
+			return err
+		}
+		err = client.sendPb(ctx, body, rawSize, compression)
+		if err == nil || attempt >= client.maxRetries || !isRetryable(err) {
+			return err
+		}
+		timer := time.NewTimer(retryBackoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// limit waits for the rate limits of a request sending size bytes, as compressed
+func (client *SlsClient) limit(ctx context.Context, size int, live bool) error {
+	if err := client.requestLimiter.wait(ctx, 1, live); err != nil {
+		return err
+	}
+	return client.bytesLimiter.wait(ctx, size, live)
+}
+
+// retryBackoff doubles from DefaultRetryBackoff up to MaxRetryBackoff, with jitter
+func retryBackoff(attempt int) time.Duration {
+	backoff := MaxRetryBackoff
+	if attempt < 8 {
+		backoff = DefaultRetryBackoff << uint(attempt)
+		if backoff > MaxRetryBackoff {
+			backoff = MaxRetryBackoff
+		}
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// sendPb posts an encoded log group, rawSize is the size before compression if compressed
+func (client *SlsClient) sendPb(ctx context.Context, logContent []byte, rawSize int, compression Compression) error {
 	method := "POST"
 	resource := "/logstores/" + client.logStore + "/shards/lb"
 	headers := make(map[string]string)
@@ -217,38 +283,44 @@ func (client *SlsClient) sendPb(logContent []byte) error {
 	headers[HeaderContentMd5] = strMd5
 	headers[HeaderLogSignatureMethod] = SlsSignatureMethod
 	headers[HeaderContentLength] = fmt.Sprintf("%v", len(logContent))
-	headers[HeaderLogBodyRawSize] = "0"
-	headers[HeaderHost] = client.endpoint
-	headers[HeaderDate] = time.Now().UTC().Format(http.TimeFormat)
+	headers[HeaderLogBodyRawSize] = strconv.Itoa(rawSize)
+	if compression != CompressNone {
+		headers[HeaderLogCompressType] = string(compression)
+	}
+	headers[HeaderDate] = client.now().UTC().Format(http.TimeFormat)
 	sign := APISign(client.accessSecret, method, headers, resource)
 	headers[HeaderAuthorization] = fmt.Sprintf("LOG %s:%s", client.accessKey, sign)
 
-	url := client.endpoint + resource
-	postBodyReader := bytes.NewBuffer(logContent)
-
-	req, err := http.NewRequest(method, url, postBodyReader)
-	if err != nil {
-		return errors.WithMessage(err, "Error creating http request for sls")
-	}
-	for header, value := range headers {
-		req.Header.Add(header, value)
-	}
-
-	resp, err := client.client.Do(req)
+	var bodies []*bodyReader
 	defer func() {
-		if resp != nil {
-			_ = resp.Body.Close()
+		for _, body := range bodies {
+			body.detach()
 		}
 	}()
+	resp, e, err := client.do(ctx, func(ctx context.Context, e *endpoint) (*http.Request, error) {
+		body := &bodyReader{data: logContent}
+		bodies = append(bodies, body)
+		req, err := http.NewRequestWithContext(ctx, method, e.url+resource, body)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Error creating http request for sls")
+		}
+		req.ContentLength = int64(len(logContent))
+		req.Host = e.host
+		for header, value := range headers {
+			req.Header.Add(header, value)
+		}
+		return req, nil
+	})
 	if err != nil {
-		return errors.WithMessage(err, "Error sending log with http client")
+		return err
 	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		return errors.New(string(body))
+		client.observeDate(resp)
+		return newAPIError(resp)
 	}
+	client.served(e)
 	return nil
 }
@@ -1,9 +1,21 @@
 package hook_test
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gogo/protobuf/proto"
 	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,3 +34,180 @@ func TestCreateClient(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "Sls log store should not be empty", err.Error())
 }
+
+func TestOversizeTruncate(t *testing.T) {
+	server := newServer(t)
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", Topic: "test", Timeout: hook.DefaultTimeout})
+	assert.Nil(t, err)
+	assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(hook.MaxLogItemSize)}))
+
+	group := receiveGroups(t, server, 1)[0]
+	assert.Equal(t, 1, len(group.Logs))
+	log := group.Logs[0]
+	assert.True(t, log.Size() <= hook.MaxLogItemSize)
+	level, _ := slstest.Value(log, "level")
+	assert.Equal(t, "ERROR", level)
+	message, _ := slstest.Value(log, "message")
+	stack, _ := slstest.Value(log, "stack")
+	assert.True(t, len(message) < hook.MaxLogItemSize)
+	assert.Equal(t, len(message), len(stack))
+	marker, ok := slstest.Value(log, hook.TruncatedKey)
+	assert.True(t, ok)
+	assert.Equal(t, fmt.Sprintf(`[{"index":1,"key":"message","length":%d},{"index":2,"key":"stack","length":%d}]`, hook.MaxLogItemSize, hook.MaxLogItemSize/2), marker)
+}
+
+func TestOversizeTruncateManyKeys(t *testing.T) {
+	server := newServer(t)
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", Topic: "test", Timeout: hook.DefaultTimeout})
+	assert.Nil(t, err)
+	// The marker of thousands of truncated values is far beyond the reserved space
+	log := &hook.Log{Time: proto.Uint32(uint32(time.Now().Unix()))}
+	for i := 0; i < 4000; i++ {
+		// Every key is repeated twice
+		key := fmt.Sprintf("field_%d", i/2)
+		log.Contents = append(log.Contents, &hook.LogContent{Key: proto.String(key), Value: proto.String(strings.Repeat("v", 256))})
+	}
+	assert.Nil(t, client.SendLogs([]*hook.Log{log}))
+
+	group := receiveGroups(t, server, 1)[0]
+	assert.Equal(t, 1, len(group.Logs))
+	truncated := group.Logs[0]
+	assert.True(t, truncated.Size() <= hook.MaxLogItemSize)
+	marker, ok := slstest.Value(truncated, hook.TruncatedKey)
+	assert.True(t, ok)
+	var originals []struct {
+		Index  int    `json:"index"`
+		Key    string `json:"key"`
+		Length int    `json:"length"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(marker), &originals))
+	// Every duplicate key is recorded by its index
+	assert.Equal(t, 4000, len(originals))
+	for i, original := range originals {
+		assert.Equal(t, i, original.Index)
+		assert.Equal(t, fmt.Sprintf("field_%d", i/2), original.Key)
+		assert.Equal(t, 256, original.Length)
+	}
+}
+
+func TestOversizeSplit(t *testing.T) {
+	server := newServer(t)
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", Topic: "test", Timeout: hook.DefaultTimeout, OversizePolicy: hook.OversizeSplit})
+	assert.Nil(t, err)
+	log := hugeLog(hook.MaxLogItemSize * 2)
+	log.Contents[2].Value = proto.String("stack")
+	assert.Nil(t, client.SendLogs([]*hook.Log{log}))
+
+	group := receiveGroups(t, server, 1)[0]
+	assert.Equal(t, 3, len(group.Logs))
+	var message string
+	id, _ := slstest.Value(group.Logs[0], hook.ChunkIDKey)
+	for i, log := range group.Logs {
+		assert.True(t, log.Size() <= hook.MaxLogItemSize)
+		stack, _ := slstest.Value(log, "stack")
+		assert.Equal(t, "stack", stack)
+		chunk, _ := slstest.Value(log, "message")
+		message += chunk
+		chunkID, _ := slstest.Value(log, hook.ChunkIDKey)
+		assert.Equal(t, id, chunkID)
+		index, _ := slstest.Value(log, hook.ChunkIndexKey)
+		assert.Equal(t, fmt.Sprint(i), index)
+		count, _ := slstest.Value(log, hook.ChunkCountKey)
+		assert.Equal(t, "3", count)
+	}
+	assert.Equal(t, strings.Repeat("m", hook.MaxLogItemSize*2), message)
+}
+
+func benchmarkSendLogs(b *testing.B, count int, size int) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		_, _ = io.Copy(ioutil.Discard, req.Body)
+		writer.WriteHeader(200)
+	}))
+	defer server.Close()
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", Topic: "test", Timeout: hook.DefaultTimeout})
+	assert.Nil(b, err)
+	logs := make([]*hook.Log, count)
+	for i := range logs {
+		logs[i] = &hook.Log{
+			Time: proto.Uint32(uint32(time.Now().Unix())),
+			Contents: []*hook.LogContent{
+				{Key: proto.String("level"), Value: proto.String("INFO")},
+				{Key: proto.String("location"), Value: proto.String("client_test.go#42")},
+				{Key: proto.String("message"), Value: proto.String(strings.Repeat("m", size))},
+			},
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := client.SendLogs(logs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSendLogs(b *testing.B) {
+	benchmarkSendLogs(b, 300, 100)
+}
+
+func BenchmarkSendLogsSplit(b *testing.B) {
+	benchmarkSendLogs(b, 300, 32*1024)
+}
+
+func TestSendLogsContext(t *testing.T) {
+	server := newServer(t)
+	server.Inject(slstest.Latency(500*time.Millisecond), 0)
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", Topic: "test", Timeout: hook.DefaultTimeout})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = client.SendLogsContext(ctx, []*hook.Log{hugeLog(16)})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 250*time.Millisecond)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, client.PingContext(ctx))
+}
+
+func TestSendLogsRetry(t *testing.T) {
+	server := newServer(t)
+	server.Inject(slstest.InternalError(), 1)
+	server.Inject(slstest.QuotaExceeded(), 1)
+	var requests int32
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", Topic: "test", Timeout: hook.DefaultTimeout,
+		Transport: interceptPosts(func(req *http.Request) {
+			atomic.AddInt32(&requests, 1)
+		}),
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(16)}))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	assert.Equal(t, 1, len(server.Received()))
+
+	// Not retryable
+	server.Inject(slstest.Fault{Status: 400, Code: "PostBodyInvalid", Message: "invalid body"}, 0)
+	err = client.SendLogs([]*hook.Log{hugeLog(16)})
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+	apiError, ok := err.(*hook.APIError)
+	assert.True(t, ok)
+	assert.Equal(t, 400, apiError.StatusCode)
+	assert.Equal(t, "PostBodyInvalid", apiError.Code)
+	assert.Equal(t, "Sls api error 400 PostBodyInvalid: invalid body", apiError.Error())
+}
+
+func TestSendLogsCompressed(t *testing.T) {
+	server := newServer(t)
+	for i, compression := range []hook.Compression{hook.CompressLZ4, hook.CompressDeflate} {
+		client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", Topic: "test", Timeout: hook.DefaultTimeout, Compression: compression})
+		assert.Nil(t, err)
+		assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(1024), hugeLog(2048)}))
+		group := receiveGroups(t, server, i+1)[i]
+		assert.Equal(t, compression, server.Received()[i].Compression)
+		assert.Equal(t, 2, len(group.Logs))
+		message, _ := slstest.Value(group.Logs[1], "message")
+		assert.Equal(t, strings.Repeat("m", 2048), message)
+	}
+}
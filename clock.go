@@ -0,0 +1,33 @@
+package hook
+
+import (
+	"net/http"
+	"time"
+)
+
+// MinClockSkew below which the local clock is trusted, as the Date header is precise to seconds
+const MinClockSkew = 2 * time.Second
+
+// observeDate updates the clock offset from the Date header of a response
+func (client *SlsClient) observeDate(resp *http.Response) {
+	date, err := http.ParseTime(resp.Header.Get(HeaderDate))
+	if err != nil {
+		return
+	}
+	offset := time.Until(date)
+	if offset > -MinClockSkew && offset < MinClockSkew {
+		offset = 0
+	}
+	client.clockOffset.Store(int64(offset))
+}
+
+// ClockOffset of the sls server clock to the local clock, detected from the
+// Date header of ping & error responses
+func (client *SlsClient) ClockOffset() time.Duration {
+	return time.Duration(client.clockOffset.Load())
+}
+
+// now is the local time corrected by the clock offset
+func (client *SlsClient) now() time.Time {
+	return time.Now().Add(client.ClockOffset())
+}
@@ -0,0 +1,36 @@
+package hook_test
+
+import (
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSkew(t *testing.T) {
+	server := newServer(t)
+	// The server clock is ahead, rejecting requests signed by other clocks
+	server.ClockSkew = time.Hour
+	server.MaxClockSkew = 15 * time.Second
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), client.ClockOffset())
+	// Rejected first, then signed again with the detected offset
+	assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(16)}))
+	receiveGroups(t, server, 1)
+	assert.InDelta(t, float64(time.Hour), float64(client.ClockOffset()), float64(2*time.Second))
+}
+
+func TestCorrectLogTime(t *testing.T) {
+	server := newServer(t)
+	// The offset is detected by the ping of the producer, accepted as it is
+	server.ClockSkew = -time.Hour
+	server.MaxClockSkew = 2 * time.Hour
+	producer := newTestProducer(t, server, hook.WithLogTimeCorrection())
+	assert.InDelta(t, float64(-time.Hour), float64(producer.ClockOffset()), float64(2*time.Second))
+	now := time.Now()
+	assert.Nil(t, producer.SendMap(now, map[string]string{"message": "skewed"}))
+	group := receiveGroups(t, server, 1)[0]
+	assert.InDelta(t, now.Add(-time.Hour).Unix(), int64(group.Logs[0].GetTime()), 2)
+}
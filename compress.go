@@ -0,0 +1,71 @@
+package hook
+
+import (
+	"bytes"
+	"compress/zlib"
+	"sync"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+)
+
+// Compression of request bodies, sent as x-log-compresstype
+type Compression string
+
+// Compressions supported by sls
+const (
+	CompressNone    Compression = ""
+	CompressLZ4     Compression = "lz4"
+	CompressDeflate Compression = "deflate"
+)
+
+// ParseCompression parses a compression name, "none" or empty for no compression
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return CompressNone, nil
+	case string(CompressLZ4):
+		return CompressLZ4, nil
+	case string(CompressDeflate):
+		return CompressDeflate, nil
+	}
+	return CompressNone, errors.Errorf("Unknown sls compression %q", name)
+}
+
+var zlibWriterPool = sync.Pool{
+	New: func() interface{} {
+		return zlib.NewWriter(nil)
+	},
+}
+
+// compress compresses data into a pooled buffer, returning nil when data is incompressible
+func compress(compression Compression, data []byte) (*[]byte, error) {
+	switch compression {
+	case CompressLZ4:
+		buf := acquireBuffer(lz4.CompressBlockBound(len(data)))
+		n, err := lz4.CompressBlock(data, *buf, nil)
+		if err != nil || n == 0 || n >= len(data) {
+			releaseBuffer(buf)
+			return nil, err
+		}
+		*buf = (*buf)[:n]
+		return buf, nil
+	case CompressDeflate:
+		buf := acquireBuffer(0)
+		out := bytes.NewBuffer(*buf)
+		writer := zlibWriterPool.Get().(*zlib.Writer)
+		defer zlibWriterPool.Put(writer)
+		writer.Reset(out)
+		if _, err := writer.Write(data); err != nil {
+			releaseBuffer(buf)
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			releaseBuffer(buf)
+			return nil, err
+		}
+		*buf = out.Bytes()
+		return buf, nil
+	}
+	return nil, nil
+}
@@ -13,4 +13,6 @@ const (
 	HeaderLogVersion         = "x-log-apiversion"
 	HeaderLogSignatureMethod = "x-log-signaturemethod"
 	HeaderLogBodyRawSize     = "x-log-bodyrawsize"
+	HeaderLogCompressType    = "x-log-compresstype"
+	HeaderLogRequestID       = "x-log-requestid"
 )
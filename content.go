@@ -0,0 +1,55 @@
+package hook
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+type location struct {
+	location string
+	// internal frames are in logrus or this package
+	internal bool
+}
+
+var locations = struct {
+	sync.RWMutex
+	m map[uintptr]location
+}{m: make(map[uintptr]location)}
+
+// cachedLocation formats the location of a return pc, caching it by pc
+func cachedLocation(pc uintptr) location {
+	locations.RLock()
+	loc, ok := locations.m[pc]
+	locations.RUnlock()
+	if ok {
+		return loc
+	}
+	name := getFunctionName(pc)
+	file, line := getFileLocation(pc)
+	loc = location{
+		location: fmt.Sprintf("%s#%d", file, line),
+		internal: strings.HasPrefix(name, "github.com/sirupsen/logrus") || strings.HasPrefix(name, "github.com/innopals/sls-logrus-hook."),
+	}
+	locations.Lock()
+	locations.m[pc] = loc
+	locations.Unlock()
+	return loc
+}
+
+func getFileLocation(f uintptr) (string, int) {
+	fn := runtime.FuncForPC(f - 1)
+	if fn == nil {
+		return "unknown", 0
+	}
+	return fn.FileLine(f - 1)
+}
+
+func getFunctionName(f uintptr) string {
+	fn := runtime.FuncForPC(f - 1)
+	if fn == nil {
+		return "unknown"
+	}
+	return fn.Name()
+}
@@ -0,0 +1,227 @@
+package hook
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// parseEndpoint parses a bare host or an http(s) url into the base url of
+// sls api & the host of requests. Bare hosts default to https.
+func parseEndpoint(endpoint string) (baseURL string, host string, err error) {
+	raw := strings.TrimSpace(endpoint)
+	if len(raw) == 0 {
+		return "", "", errors.New("Sls endpoint should not be empty")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", errors.Errorf("Invalid sls endpoint %q", endpoint)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", errors.Errorf("Invalid sls endpoint %q, scheme should be http or https", endpoint)
+	}
+	if u.User != nil {
+		return "", "", errors.Errorf("Invalid sls endpoint %q, user info is not allowed", endpoint)
+	}
+	if (len(u.Path) > 0 && u.Path != "/") || len(u.RawQuery) > 0 || len(u.Fragment) > 0 || u.ForceQuery {
+		return "", "", errors.Errorf("Invalid sls endpoint %q, path, query & fragment are not allowed", endpoint)
+	}
+	if len(u.Hostname()) == 0 {
+		return "", "", errors.Errorf("Invalid sls endpoint %q, host should not be empty", endpoint)
+	}
+	if port := u.Port(); len(port) > 0 {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return "", "", errors.Errorf("Invalid sls endpoint %q, invalid port %q", endpoint, port)
+		}
+	} else if strings.HasSuffix(u.Host, ":") {
+		return "", "", errors.Errorf("Invalid sls endpoint %q, port should not be empty", endpoint)
+	}
+	if strings.Contains(u.Hostname(), ":") && net.ParseIP(u.Hostname()) == nil {
+		return "", "", errors.Errorf("Invalid sls endpoint %q, invalid ipv6 host", endpoint)
+	}
+	host = strings.ToLower(u.Host)
+	return u.Scheme + "://" + host, host, nil
+}
+
+// DefaultEndpointProbeInterval between probes of failed endpoints
+const DefaultEndpointProbeInterval = 30 * time.Second
+
+// EndpointStats of an sls endpoint
+type EndpointStats struct {
+	Endpoint string
+	// Healthy unless the last request failed to connect
+	Healthy bool
+	// Active endpoint serves the next request
+	Active bool
+	// Batches of logs served
+	Batches uint64
+	// Failures to connect
+	Failures uint64
+}
+
+// endpoint of sls api with health tracking, guarded by the client lock
+type endpoint struct {
+	url      string
+	host     string
+	healthy  bool
+	failedAt time.Time
+	batches  uint64
+	failures uint64
+}
+
+// parseEndpoints parses config.Endpoint followed by config.Endpoints, in order of preference
+func parseEndpoints(config *Config) ([]*endpoint, error) {
+	raws := config.Endpoints
+	if len(config.Endpoint) > 0 {
+		raws = append([]string{config.Endpoint}, raws...)
+	}
+	endpoints := make([]*endpoint, 0, len(raws))
+	for _, raw := range raws {
+		url, host, err := parseEndpoint(raw)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, &endpoint{url: url, host: host, healthy: true})
+	}
+	return endpoints, nil
+}
+
+// candidates orders healthy endpoints by preference followed by failed ones
+// as last resort, probing failed preferred endpoints in background.
+func (client *SlsClient) candidates() []*endpoint {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	candidates := make([]*endpoint, 0, len(client.endpoints))
+	probe := false
+	for _, e := range client.endpoints {
+		if e.healthy {
+			candidates = append(candidates, e)
+		} else if len(candidates) == 0 && time.Since(e.failedAt) >= client.probeInterval {
+			probe = true
+		}
+	}
+	for _, e := range client.endpoints {
+		if !e.healthy {
+			candidates = append(candidates, e)
+		}
+	}
+	if probe && !client.probing {
+		client.probing = true
+		go client.probe()
+	}
+	return candidates
+}
+
+// do sends requests built for each candidate endpoint until one is reachable
+func (client *SlsClient) do(ctx context.Context, build func(ctx context.Context, e *endpoint) (*http.Request, error)) (*http.Response, *endpoint, error) {
+	var lastErr error
+	for _, e := range client.candidates() {
+		req, err := build(ctx, e)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := client.client.Do(req)
+		if err == nil {
+			client.markHealthy(e)
+			return resp, e, nil
+		}
+		lastErr = errors.WithMessage(err, "Error sending log with http client")
+		if ctx.Err() != nil {
+			break
+		}
+		client.markFailed(e)
+	}
+	return nil, nil, lastErr
+}
+
+// probe pings failed endpoints preferred to the active one, which are used again once served
+func (client *SlsClient) probe() {
+	defer func() {
+		client.lock.Lock()
+		client.probing = false
+		client.lock.Unlock()
+	}()
+	client.lock.Lock()
+	var failed []*endpoint
+	for _, e := range client.endpoints {
+		if e.healthy {
+			break
+		}
+		if time.Since(e.failedAt) >= client.probeInterval {
+			failed = append(failed, e)
+		}
+	}
+	client.lock.Unlock()
+	for _, e := range failed {
+		ctx, cancel := context.WithTimeout(context.Background(), client.timeout)
+		req, err := client.pingRequest(ctx, e)
+		if err == nil {
+			var resp *http.Response
+			if resp, err = client.client.Do(req); err == nil {
+				_ = resp.Body.Close()
+				// Only a served ping recovers the endpoint, errors would fail over again
+				if resp.StatusCode != http.StatusOK {
+					err = errors.Errorf("Sls endpoint responded %d", resp.StatusCode)
+				}
+			}
+		}
+		cancel()
+		if err != nil {
+			client.markFailed(e)
+			continue
+		}
+		client.markHealthy(e)
+	}
+}
+
+func (client *SlsClient) markHealthy(e *endpoint) {
+	client.lock.Lock()
+	e.healthy = true
+	client.lock.Unlock()
+}
+
+func (client *SlsClient) markFailed(e *endpoint) {
+	client.lock.Lock()
+	e.healthy = false
+	e.failedAt = time.Now()
+	e.failures++
+	client.lock.Unlock()
+}
+
+func (client *SlsClient) served(e *endpoint) {
+	client.lock.Lock()
+	e.batches++
+	client.lock.Unlock()
+}
+
+// EndpointStats reports health & served batches of each endpoint, in order of preference
+func (client *SlsClient) EndpointStats() []EndpointStats {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	stats := make([]EndpointStats, len(client.endpoints))
+	active := false
+	for i, e := range client.endpoints {
+		stats[i] = EndpointStats{
+			Endpoint: e.url,
+			Healthy:  e.healthy,
+			Active:   e.healthy && !active,
+			Batches:  e.batches,
+			Failures: e.failures,
+		}
+		active = active || e.healthy
+	}
+	if !active && len(stats) > 0 {
+		stats[0].Active = true
+	}
+	return stats
+}
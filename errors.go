@@ -0,0 +1,141 @@
+package hook
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/innopals/sls-logrus-hook/internal/field"
+	"github.com/pkg/errors"
+)
+
+// maxErrorDepth bounds walking error chains, guarding against cycles
+const maxErrorDepth = 32
+
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// unwrapError returns the errors wrapped by err, supporting Go 1.13 wrapping,
+// pkg/errors causes & multi-errors
+func unwrapError(err error) []error {
+	switch err := err.(type) {
+	case interface{ Unwrap() []error }:
+		return err.Unwrap()
+	case interface{ Errors() []error }:
+		return err.Errors()
+	case interface{ Unwrap() error }:
+		if cause := err.Unwrap(); cause != nil {
+			return []error{cause}
+		}
+	case interface{ Cause() error }:
+		if cause := err.Cause(); cause != nil {
+			return []error{cause}
+		}
+	}
+	return nil
+}
+
+// appendError splits an error field into key.message, key.type, key.stack & key.cause contents,
+// or formats it as a single content if a method of the chain panics, e.g. on a typed nil pointer
+func appendError(log *Log, key string, err error) {
+	message, errType, stack, cause, ok := splitError(err)
+	if !ok {
+		appendContent(log, key, field.Format(err))
+		return
+	}
+	appendContent(log, key+".message", message)
+	appendContent(log, key+".type", errType)
+	if len(stack) > 0 {
+		appendContent(log, key+".stack", stack)
+	}
+	if len(cause) > 0 {
+		appendContent(log, key+".cause", cause)
+	}
+}
+
+func splitError(err error) (message string, errType string, stack string, cause string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return err.Error(), errorType(err), errorStack(err), errorCause(err), true
+}
+
+// errorType is the type of the innermost error of a single wrapping chain,
+// stopping at multi-errors
+func errorType(err error) string {
+	for depth := 0; depth < maxErrorDepth; depth++ {
+		switch err.(type) {
+		case interface{ Unwrap() []error }, interface{ Errors() []error }:
+			return fmt.Sprintf("%T", err)
+		}
+		causes := unwrapError(err)
+		if len(causes) == 0 {
+			break
+		}
+		err = causes[0]
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// errorStack formats the deepest stack trace of the chain, which is closest to the origin,
+// as one "function file#line" frame per line
+func errorStack(err error) string {
+	var stack errors.StackTrace
+	maxDepth := -1
+	walkError(err, 0, func(err error, depth int) {
+		if tracer, ok := err.(stackTracer); ok && depth > maxDepth {
+			stack, maxDepth = tracer.StackTrace(), depth
+		}
+	})
+	var b strings.Builder
+	for i, frame := range stack {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		file, line := getFileLocation(uintptr(frame))
+		_, _ = fmt.Fprintf(&b, "%s %s#%d", getFunctionName(uintptr(frame)), file, line)
+	}
+	return b.String()
+}
+
+// errorCause lists the wrapped errors as "type: message" lines, indented by depth.
+// Wrappers adding no message, like pkg/errors stacks, are skipped.
+func errorCause(err error) string {
+	var b strings.Builder
+	var visit func(err error, message string, depth int)
+	visit = func(err error, message string, depth int) {
+		if depth >= maxErrorDepth {
+			return
+		}
+		for _, cause := range unwrapError(err) {
+			if cause == nil {
+				continue
+			}
+			causeMessage := cause.Error()
+			causeDepth := depth
+			if causeMessage != message {
+				if b.Len() > 0 {
+					b.WriteByte('\n')
+				}
+				b.WriteString(strings.Repeat("  ", depth))
+				_, _ = fmt.Fprintf(&b, "%T: %s", cause, causeMessage)
+				causeDepth++
+			}
+			visit(cause, causeMessage, causeDepth)
+		}
+	}
+	visit(err, err.Error(), 0)
+	return b.String()
+}
+
+func walkError(err error, depth int, fn func(err error, depth int)) {
+	if err == nil || depth >= maxErrorDepth {
+		return
+	}
+	fn(err, depth)
+	for _, cause := range unwrapError(err) {
+		walkError(cause, depth+1, fn)
+	}
+}
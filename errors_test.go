@@ -0,0 +1,87 @@
+package hook_test
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type multiError []error
+
+func (m multiError) Error() string {
+	return fmt.Sprintf("%d errors occurred", len(m))
+}
+
+func (m multiError) Errors() []error {
+	return m
+}
+
+type pointerError struct {
+	message string
+}
+
+func (e *pointerError) Error() string {
+	return e.message
+}
+
+func TestErrorFields(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	logger := logrus.New()
+	logger.AddHook(hook.NewHookWithProducer(producer))
+	logger.SetFormatter(&hook.NoopFormatter{})
+	logger.SetOutput(ioutil.Discard)
+
+	wrapped := fmt.Errorf("load config: %w", errors.Wrap(os.ErrNotExist, "open file"))
+	logger.WithError(wrapped).Error("pkg errors")
+	logger.WithError(stderrors.Join(stderrors.New("first"), stderrors.New("second"))).Error("joined")
+	logger.WithField("failures", multiError{stderrors.New("third")}).Error("multi")
+	logs := receiveLogs(t, server, 3)
+
+	assert.Equal(t, "load config: open file: file does not exist", logs[0]["error.message"])
+	assert.Equal(t, "*errors.errorString", logs[0]["error.type"])
+	assert.Equal(t, "*errors.withStack: open file: file does not exist\n  *errors.errorString: file does not exist", logs[0]["error.cause"])
+	frames := strings.Split(logs[0]["error.stack"], "\n")
+	assert.True(t, strings.HasPrefix(frames[0], "github.com/innopals/sls-logrus-hook_test.TestErrorFields "))
+	assert.True(t, strings.Contains(frames[0], "errors_test.go#"))
+	_, ok := logs[0]["error"]
+	assert.False(t, ok)
+
+	assert.Equal(t, "first\nsecond", logs[1]["error.message"])
+	assert.Equal(t, "*errors.joinError", logs[1]["error.type"])
+	assert.Equal(t, "*errors.errorString: first\n*errors.errorString: second", logs[1]["error.cause"])
+	_, ok = logs[1]["error.stack"]
+	assert.False(t, ok)
+
+	assert.Equal(t, "1 errors occurred", logs[2]["failures.message"])
+	assert.Equal(t, "hook_test.multiError", logs[2]["failures.type"])
+	assert.Equal(t, "*errors.errorString: third", logs[2]["failures.cause"])
+}
+
+func TestNilErrorFields(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	logger := logrus.New()
+	logger.AddHook(hook.NewHookWithProducer(producer))
+	logger.SetFormatter(&hook.NoopFormatter{})
+	logger.SetOutput(ioutil.Discard)
+
+	logger.WithError((*pointerError)(nil)).Error("typed nil")
+	logger.WithError(fmt.Errorf("wrapped: %w", (*pointerError)(nil))).Error("wrapped typed nil")
+	logs := receiveLogs(t, server, 2)
+
+	assert.Equal(t, "<nil>", logs[0]["error"])
+	_, ok := logs[0]["error.message"]
+	assert.False(t, ok)
+	assert.Equal(t, "wrapped: <nil>", logs[1]["error"])
+}
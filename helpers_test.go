@@ -0,0 +1,106 @@
+package hook_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newServer starts a sls server accepting the test credentials, closed once the test ends
+func newServer(t *testing.T) *slstest.Server {
+	server := slstest.NewServer("test", "test")
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProducer(t *testing.T, server *slstest.Server, opts ...hook.Option) *hook.Producer {
+	producer, err := hook.NewProducer(append(append(server.Options(),
+		hook.WithLogStore("test"),
+		hook.WithTopic("test"),
+		hook.WithSendInterval(10*time.Millisecond),
+	), opts...)...)
+	assert.Nil(t, err)
+	return producer
+}
+
+// receiveGroups waits until server received count log groups, returning them in order
+func receiveGroups(t *testing.T, server *slstest.Server, count int) []*hook.LogGroup {
+	deadline := time.Now().Add(time.Second)
+	for {
+		received := server.Received()
+		if len(received) >= count {
+			groups := make([]*hook.LogGroup, len(received))
+			for i, r := range received {
+				groups[i] = r.Group
+			}
+			return groups
+		}
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			t.Fatalf("Sls server should have received %d log groups, got %d", count, len(received))
+		}
+		// Every log group brings a log at least
+		server.Wait(timeout, len(server.Logs())+1)
+	}
+}
+
+// receiveLogs waits until server received count logs, returning their contents in order
+func receiveLogs(t *testing.T, server *slstest.Server, count int) []map[string]string {
+	received := server.Wait(time.Second, count)
+	if len(received) < count {
+		t.Fatalf("Sls server should have received %d logs, got %d", count, len(received))
+	}
+	logs := make([]map[string]string, len(received))
+	for i, log := range received {
+		logs[i] = slstest.Fields(log)
+	}
+	return logs
+}
+
+func hugeLog(size int) *hook.Log {
+	return &hook.Log{
+		Time: proto.Uint32(uint32(time.Now().Unix())),
+		Contents: []*hook.LogContent{
+			{Key: proto.String("level"), Value: proto.String("ERROR")},
+			{Key: proto.String("message"), Value: proto.String(strings.Repeat("m", size))},
+			{Key: proto.String("stack"), Value: proto.String(strings.Repeat("s", size/2))},
+		},
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// interceptPosts is a transport calling intercept before every log post is sent
+func interceptPosts(intercept func(req *http.Request)) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == http.MethodPost {
+			intercept(req)
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+// blockFirstPost is a transport holding the first log post until release is
+// closed, once started is received from
+func blockFirstPost() (transport http.RoundTripper, started chan struct{}, release chan struct{}) {
+	started = make(chan struct{})
+	release = make(chan struct{})
+	transport = interceptPosts(func(req *http.Request) {
+		select {
+		case started <- struct{}{}:
+			<-release
+		default:
+		}
+	})
+	return transport, started, release
+}
@@ -1,241 +1,163 @@
 package hook
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"os"
-	"os/signal"
 	"runtime"
+	"runtime/debug"
 	"strings"
-	"sync"
-	"syscall"
 	"time"
 
-	"github.com/gogo/protobuf/proto"
+	"github.com/innopals/sls-logrus-hook/internal/field"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// Default config for sls logrus hooks
-const (
-	BufferSize          = 4096
-	DefaultSendInterval = 300 * time.Millisecond
-	MaxBatchSize        = 300
-)
-
-type Config struct {
-	Endpoint     string
-	AccessKey    string
-	AccessSecret string
-	LogStore     string
-	Topic        string
-	Timeout      time.Duration
-}
-
 // SlsLogrusHook logrus hook for sls
 type SlsLogrusHook struct {
-	client       *SlsClient
-	sendInterval time.Duration
-	c            chan *Log
-	lock         *sync.Mutex
-	sending      bool
-	realSendLogs func(logs []*Log) error
+	producer *Producer
+	levels   []logrus.Level
 }
 
-func New(config *Config) (*SlsLogrusHook, error) {
-	client, err := NewSlsClient(config)
-	if err != nil {
+// New create logrus hook with options, or a *Config. Options are validated up
+// front and immutable once the hook is created.
+func New(opts ...Option) (*SlsLogrusHook, error) {
+	config := newConfig(opts)
+	producer, err := NewProducer(config)
+	if producer == nil {
 		return nil, errors.WithMessage(err, "Unable to create sls logrus hook")
 	}
-	if len(config.Topic) == 0 {
-		return nil, errors.New("Sls topic should not be empty")
-	}
-	hook := &SlsLogrusHook{
-		client:       client,
-		c:            make(chan *Log, BufferSize),
-		lock:         &sync.Mutex{},
-		sending:      false,
-		sendInterval: DefaultSendInterval,
+	hook := NewHookWithProducer(producer)
+	if config.Levels != nil {
+		hook.levels = append([]logrus.Level{}, config.Levels...)
 	}
-	err = client.Ping()
-	if err != nil {
-		hook.realSendLogs = fallbackSendLogs
-		_, _ = fmt.Fprintf(os.Stderr, "Fail to send logs to sls, fallback to stdout. error: %v", err.Error())
-	} else {
-		hook.realSendLogs = client.SendLogs
-	}
-	var gracefulStop = make(chan os.Signal)
-	signal.Notify(gracefulStop, syscall.SIGTERM)
-	signal.Notify(gracefulStop, syscall.SIGINT)
-	go func() {
-		<-gracefulStop
-		fmt.Println("Flushing logs")
-		time.Sleep(time.Second)
-	}()
 	return hook, err
 }
 
+// NewHookWithProducer create logrus hook sending logs through producer
+func NewHookWithProducer(producer *Producer) *SlsLogrusHook {
+	return &SlsLogrusHook{producer: producer, levels: logrus.AllLevels}
+}
+
+// Producer returns the producer the hook sends logs through
+func (hook *SlsLogrusHook) Producer() *Producer {
+	return hook.producer
+}
+
 // NewSlsLogrusHook create logrus hook
 func NewSlsLogrusHook(endpoint string, accessKey string, accessSecret string, logStore string, topic string) (*SlsLogrusHook, error) {
 	return New(&Config{
-		endpoint,
-		accessKey,
-		accessSecret,
-		logStore,
-		topic,
-		DefaultTimeout,
+		Endpoint:     endpoint,
+		AccessKey:    accessKey,
+		AccessSecret: accessSecret,
+		LogStore:     logStore,
+		Topic:        topic,
+		Timeout:      DefaultTimeout,
 	})
 }
 
-// SetSendInterval change batch send interval
+// SetSendInterval change batch send interval, which is immutable once the hook starts sending.
+//
+// Deprecated: Use WithSendInterval or Config.SendInterval.
 func (hook *SlsLogrusHook) SetSendInterval(interval time.Duration) {
-	hook.sendInterval = interval
+	hook.producer.SetSendInterval(interval)
 }
 
 // Fire implement logrus Hook interface
 func (hook *SlsLogrusHook) Fire(entry *logrus.Entry) error {
-	const depth = 16
-	var pcs [depth]uintptr
-	n := runtime.Callers(5, pcs[:])
-	var location string
-	for _, pc := range pcs[0:n] {
-		if !strings.HasPrefix(getFunctionName(pc), "github.com/sirupsen/logrus") {
-			file, line := getFileLocation(pc)
-			location = fmt.Sprintf("%s#%d", file, line)
-			break
-		}
-	}
+	return hook.FireContext(context.Background(), entry)
+}
 
-	log := &Log{
-		Time: proto.Uint32(uint32(time.Now().Unix())),
-		Contents: []*LogContent{
-			{
-				Key:   proto.String("level"),
-				Value: proto.String(strings.ToUpper(entry.Level.String())),
-			},
-			{
-				Key:   proto.String("location"),
-				Value: proto.String(location),
-			},
-			{
-				Key:   proto.String("message"),
-				Value: proto.String(entry.Message),
-			},
-		},
+// FireContext queues the entry for sending, giving up when ctx is done before
+// there is room in the buffer.
+func (hook *SlsLogrusHook) FireContext(ctx context.Context, entry *logrus.Entry) error {
+	log := acquireLog(uint32(time.Now().Unix()))
+	appendContent(log, "level", levelName(entry.Level))
+	appendContent(log, "location", callerLocation())
+	appendContent(log, "message", entry.Message)
+	if traceContext, ok := extractTrace(entry.Context, hook.producer.traceExtractors); ok {
+		appendTrace(log, traceContext)
 	}
 	for k, v := range entry.Data {
-		if k == "__topic__" || k == "__source__" || k == "level" || k == "message" {
-			k = "field_" + k
-		}
-		var value string
-		switch v := v.(type) {
-		case string:
-			value = v
-		case error:
-			value = fmt.Sprintf("%+v", v)
-		default:
-			bytes, err := json.Marshal(v)
-			if err != nil {
-				value = fmt.Sprintf("%+v", v)
-			} else {
-				value = string(bytes)
-			}
-		}
-		if len(value) == 0 {
+		if err, ok := v.(error); ok && err != nil {
+			appendError(log, field.Key(k), err)
 			continue
 		}
-		log.Contents = append(log.Contents, &LogContent{
-			Key:   proto.String(k),
-			Value: proto.String(value),
-		})
+		if value := field.Format(v); len(value) > 0 {
+			appendContent(log, field.Key(k), value)
+		}
 	}
-	hook.c <- log
-	if !hook.sending {
-		hook.startWork()
+	if entry.Level <= logrus.FatalLevel {
+		// logrus exits or panics right after firing hooks
+		return hook.producer.sendFatal(ctx, log)
 	}
-	return nil
+	return hook.producer.send(ctx, log)
 }
 
 // Levels implement logrus Hook interface
 func (hook *SlsLogrusHook) Levels() []logrus.Level {
-	return logrus.AllLevels
+	return hook.levels
 }
 
 // Flush ensure logs are flush through sls api
 func (hook *SlsLogrusHook) Flush(timeout time.Duration) {
-	until := time.Now().UnixNano() + int64(timeout)
-	for (hook.sending || len(hook.c) > 0) && time.Now().UnixNano() < until {
-		time.Sleep(10 * time.Millisecond)
-	}
+	hook.producer.Flush(timeout)
+}
+
+// FlushContext waits until queued logs are flushed through sls api,
+// returning ctx.Err() if ctx is done first.
+func (hook *SlsLogrusHook) FlushContext(ctx context.Context) error {
+	return hook.producer.FlushContext(ctx)
 }
 
-func (hook *SlsLogrusHook) startWork() {
-	hook.lock.Lock()
-	defer hook.lock.Unlock()
-	if hook.sending {
+// RecoverAndLog logs a recovered panic value & the full stack as a PANIC entry,
+// flushed before re-panicking with the original value. Defer it at the top of goroutines:
+//
+//	defer hook.RecoverAndLog(logger)
+func RecoverAndLog(logger logrus.FieldLogger) {
+	r := recover()
+	if r == nil {
 		return
 	}
-	hook.sending = true
-	go hook.work()
+	logPanic(logger, r, debug.Stack())
+	panic(r)
 }
 
-func (hook *SlsLogrusHook) work() {
-	for {
-		if !hook.sending {
-			return
-		}
-		deadline := time.After(hook.sendInterval)
-		logs := make([]*Log, MaxBatchSize)
-		count := 0
-	waitLoop:
-		for count < MaxBatchSize {
-			select {
-			case log := <-hook.c:
-				logs[count] = log
-				count++
-			case <-deadline:
-				break waitLoop
-			}
-		}
-		if count == 0 {
-			time.Sleep(hook.sendInterval)
-			if len(hook.c) == 0 {
-				break
-			}
-			continue
-		}
-		logs = logs[0:count]
-		if err := hook.realSendLogs(logs); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error sending logs, error: %+v\n", err)
-			_ = fallbackSendLogs(logs)
-		}
-	}
-	hook.sending = false
-	// if new logs pushed to channel before setting sending to false.
-	if len(hook.c) > 0 {
-		hook.startWork()
-	}
+func logPanic(logger logrus.FieldLogger, r interface{}, stack []byte) {
+	defer func() {
+		// logrus panics with the entry after firing hooks
+		_ = recover()
+	}()
+	logger.WithFields(logrus.Fields{
+		"panic": field.Format(r),
+		"stack": string(stack),
+	}).Panic(fmt.Sprint("Recovered panic: ", r))
 }
 
-func fallbackSendLogs(logs []*Log) error {
-	for _, log := range logs {
-		_, _ = fmt.Fprint(os.Stdout, log, "\n")
+var levelNames = func() map[logrus.Level]string {
+	names := make(map[logrus.Level]string)
+	for _, level := range logrus.AllLevels {
+		names[level] = strings.ToUpper(level.String())
 	}
-	return nil
-}
+	return names
+}()
 
-func getFileLocation(f uintptr) (string, int) {
-	fn := runtime.FuncForPC(f - 1)
-	if fn == nil {
-		return "unknown", 0
+func levelName(level logrus.Level) string {
+	if name, ok := levelNames[level]; ok {
+		return name
 	}
-	return fn.FileLine(f - 1)
+	return strings.ToUpper(level.String())
 }
 
-func getFunctionName(f uintptr) string {
-	fn := runtime.FuncForPC(f - 1)
-	if fn == nil {
-		return "unknown"
+// callerLocation finds the first caller outside logrus & this package
+func callerLocation() string {
+	const depth = 16
+	var pcs [depth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	for _, pc := range pcs[0:n] {
+		if location := cachedLocation(pc); !location.internal {
+			return location.location
+		}
 	}
-	return fn.Name()
+	return ""
 }
@@ -1,6 +1,7 @@
 package hook_test
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
@@ -9,11 +10,13 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
 	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -50,7 +53,7 @@ func TestLogs(t *testing.T) {
 		_ = mockServer.Serve(listener)
 	}()
 	port := listener.Addr().(*net.TCPAddr).Port
-	endpoint := fmt.Sprintf("127.0.0.1:%d", port)
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d", port)
 	slsLogrusHook, err := hook.NewSlsLogrusHook(endpoint, "test", "test", "test", "test")
 	assert.Nil(t, err)
 	slsLogrusHook.SetSendInterval(100 * time.Millisecond)
@@ -112,6 +115,23 @@ func TestLogs(t *testing.T) {
 	case <-time.After(300 * time.Millisecond):
 		t.Errorf("Mock server should have received a request.")
 	}
+
+	ctx := hook.ContextWithTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	logger.WithContext(ctx).Info("Traced")
+	select {
+	case wrapper := <-requests:
+		group := new(hook.LogGroup)
+		assert.Nil(t, proto.Unmarshal(wrapper.Body, group))
+		assert.Equal(t, 1, len(group.Logs))
+		assert.Equal(t, "trace_id", *group.Logs[0].Contents[3].Key)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", *group.Logs[0].Contents[3].Value)
+		assert.Equal(t, "span_id", *group.Logs[0].Contents[4].Key)
+		assert.Equal(t, "00f067aa0ba902b7", *group.Logs[0].Contents[4].Value)
+		assert.Equal(t, "trace_flags", *group.Logs[0].Contents[5].Key)
+		assert.Equal(t, "01", *group.Logs[0].Contents[5].Value)
+	case <-time.After(300 * time.Millisecond):
+		t.Errorf("Mock server should have received a request.")
+	}
 }
 
 func BenchmarkSlsHookWithogLocation(b *testing.B) {
@@ -132,7 +152,7 @@ func BenchmarkSlsHookWithogLocation(b *testing.B) {
 		_ = mockServer.Serve(listener)
 	}()
 	port := listener.Addr().(*net.TCPAddr).Port
-	endpoint := fmt.Sprintf("127.0.0.1:%d", port)
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d", port)
 	slsLogrusHook, err := hook.NewSlsLogrusHook(endpoint, "test", "test", "test", "test")
 	assert.Nil(b, err)
 	slsLogrusHook.SetSendInterval(100 * time.Millisecond)
@@ -147,6 +167,8 @@ func BenchmarkSlsHookWithogLocation(b *testing.B) {
 	logger.SetFormatter(&hook.NoopFormatter{})
 	logger.SetOutput(ioutil.Discard)
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
 		logger.Infof("Log sequence #%d", n)
 	}
@@ -160,3 +182,79 @@ func BenchmarkLogrusDefaultFormatterWithoutLogLocation(b *testing.B) {
 		logger.Infof("Log sequence #%d", n)
 	}
 }
+
+func TestFlushContext(t *testing.T) {
+	server := newServer(t)
+	release := make(chan struct{})
+	slsLogrusHook, err := hook.New(&hook.Config{
+		Endpoint:     server.URL,
+		AccessKey:    "test",
+		AccessSecret: "test",
+		LogStore:     "test",
+		Topic:        "test",
+		Timeout:      hook.DefaultTimeout,
+		Transport: interceptPosts(func(req *http.Request) {
+			<-release
+		}),
+	})
+	assert.Nil(t, err)
+	slsLogrusHook.SetSendInterval(10 * time.Millisecond)
+
+	logger := logrus.New()
+	logger.AddHook(slsLogrusHook)
+	logger.SetFormatter(&hook.NoopFormatter{})
+	logger.SetOutput(ioutil.Discard)
+	logger.Info("Hello world!")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, slsLogrusHook.FlushContext(ctx))
+
+	close(release)
+	assert.Nil(t, slsLogrusHook.FlushContext(context.Background()))
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	server := newServer(t)
+	slsLogrusHook, err := hook.New(&hook.Config{
+		Endpoint:     server.URL,
+		AccessKey:    "test",
+		AccessSecret: "test",
+		LogStore:     "test",
+		Topic:        "test",
+		Timeout:      hook.DefaultTimeout,
+	})
+	assert.Nil(t, err)
+	// Only the synchronous flush of the panic log may deliver it in time
+	slsLogrusHook.SetSendInterval(time.Hour)
+
+	logger := logrus.New()
+	logger.AddHook(slsLogrusHook)
+	logger.SetFormatter(&hook.NoopFormatter{})
+	logger.SetOutput(ioutil.Discard)
+
+	recovered := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			recovered <- recover()
+		}()
+		defer hook.RecoverAndLog(logger)
+		panic("boom")
+	}()
+	assert.Equal(t, "boom", <-recovered)
+
+	received := server.Received()
+	if len(received) == 0 {
+		t.Fatal("panic log is not flushed before re-panicking")
+	}
+	group := received[0].Group
+	assert.Equal(t, 1, len(group.Logs))
+	level, _ := slstest.Value(group.Logs[0], "level")
+	assert.Equal(t, "PANIC", level)
+	message, _ := slstest.Value(group.Logs[0], "message")
+	assert.Equal(t, "Recovered panic: boom", message)
+	value, _ := slstest.Value(group.Logs[0], "panic")
+	assert.Equal(t, "boom", value)
+	stack, _ := slstest.Value(group.Logs[0], "stack")
+	assert.True(t, strings.Contains(stack, "TestRecoverAndLog"))
+}
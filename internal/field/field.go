@@ -0,0 +1,41 @@
+// Package field formats log fields as sls contents, shared by the hook & its
+// logger integrations.
+package field
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Key renames fields conflicting with reserved sls & hook keys, e.g. level to field_level
+func Key(k string) string {
+	if k == "level" || k == "message" {
+		return "field_" + k
+	}
+	return SlsKey(k)
+}
+
+// SlsKey renames keys conflicting with reserved sls keys, used where level &
+// message are parsed as they are, e.g. lines of a Writer
+func SlsKey(k string) string {
+	if k == "__topic__" || k == "__source__" {
+		return "field_" + k
+	}
+	return k
+}
+
+// Format formats a field value as content value, errors with %+v & others as json
+func Format(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return fmt.Sprintf("%+v", v)
+	default:
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%+v", v)
+		}
+		return string(bytes)
+	}
+}
@@ -0,0 +1,89 @@
+package hook
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// replayKey marks contexts of replayed sends
+type replayKey struct{}
+
+// ContextWithReplay marks sends of ctx as replay, which yield to live traffic
+// when rate limited. Retries & Producer.Replay are replay too.
+func ContextWithReplay(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replayKey{}, true)
+}
+
+func isReplay(ctx context.Context) bool {
+	replay, _ := ctx.Value(replayKey{}).(bool)
+	return replay
+}
+
+// limiter is a token bucket holding up to one second of tokens, where live
+// traffic is served before replay
+type limiter struct {
+	lock        sync.Mutex
+	rate        float64
+	tokens      float64
+	last        time.Time
+	liveWaiting int
+}
+
+func newLimiter(rate int) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// wait takes n tokens, waiting until they are available or ctx is done.
+// Requests larger than the bucket take it whole and leave a debt.
+func (l *limiter) wait(ctx context.Context, n int, live bool) error {
+	if l == nil {
+		return nil
+	}
+	need := float64(n)
+	if need > l.rate {
+		need = l.rate
+	}
+	waiting := false
+	defer func() {
+		if waiting {
+			l.lock.Lock()
+			l.liveWaiting--
+			l.lock.Unlock()
+		}
+	}()
+	for {
+		l.lock.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+		l.last = now
+		if (live || l.liveWaiting == 0) && l.tokens >= need {
+			l.tokens -= float64(n)
+			l.lock.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - l.tokens) / l.rate * float64(time.Second))
+		if !live && l.liveWaiting > 0 && delay < 10*time.Millisecond {
+			// Check again once live traffic is served
+			delay = 10 * time.Millisecond
+		}
+		if live && !waiting {
+			waiting = true
+			l.liveWaiting++
+		}
+		l.lock.Unlock()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package hook_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	server := newServer(t)
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", RateLimitRequests: 10})
+	assert.Nil(t, err)
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(16)}))
+		receiveGroups(t, server, i+1)
+	}
+	// 10 requests in the bucket, then 10 per second
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+
+	client, err = hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", RateLimitBytes: 64 * 1024})
+	assert.Nil(t, err)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(32 * 1024)}))
+		receiveGroups(t, server, 15+i+1)
+	}
+	// 48K per request, the bucket of 64K is refilled at 64K per second
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+}
+
+func TestRateLimitPriority(t *testing.T) {
+	server := newServer(t)
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: server.URL, AccessKey: "test", AccessSecret: "test", LogStore: "test", RateLimitRequests: 5})
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(16)}))
+		receiveGroups(t, server, i+1)
+	}
+	done := make(chan string, 2)
+	go func() {
+		assert.Nil(t, client.SendLogsContext(hook.ContextWithReplay(context.Background()), []*hook.Log{hugeLog(16)}))
+		done <- "replay"
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(16)}))
+		done <- "live"
+	}()
+	assert.Equal(t, "live", <-done)
+	assert.Equal(t, "replay", <-done)
+	receiveGroups(t, server, 7)
+}
+
+func TestProducerReplay(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server, hook.WithRateLimit(0, 5))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, producer.Replay(context.Background(), []*hook.Log{hugeLog(16)}))
+		receiveGroups(t, server, i+1)
+	}
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, producer.Replay(context.Background(), []*hook.Log{hugeLog(16)}))
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// Live logs share the bucket and go first
+	assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"message": "live"}))
+	message, _ := slstest.Value(receiveGroups(t, server, 6)[5].Logs[0], "message")
+	assert.Equal(t, "live", message)
+	<-done
+	message, _ = slstest.Value(receiveGroups(t, server, 7)[6].Logs[0], "message")
+	assert.Equal(t, strings.Repeat("m", 16), message)
+}
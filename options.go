@@ -0,0 +1,262 @@
+package hook
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures a logrus hook or producer, a *Config is an Option
+// replacing every field set by previous options.
+type Option interface {
+	apply(config *Config)
+}
+
+func (config *Config) apply(dst *Config) {
+	*dst = *config
+}
+
+type optionFunc func(config *Config)
+
+func (f optionFunc) apply(config *Config) {
+	f(config)
+}
+
+// newConfig applies options on top of the defaults
+func newConfig(opts []Option) *Config {
+	config := &Config{Timeout: DefaultTimeout}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(config)
+		}
+	}
+	return config
+}
+
+// WithEndpoint sets the sls endpoint
+func WithEndpoint(endpoint string) Option {
+	return optionFunc(func(config *Config) {
+		config.Endpoint = endpoint
+	})
+}
+
+// WithEndpoints sets the endpoints failed over in order of preference
+func WithEndpoints(endpoints ...string) Option {
+	return optionFunc(func(config *Config) {
+		config.Endpoint = ""
+		config.Endpoints = endpoints
+	})
+}
+
+// WithEndpointProbeInterval sets the interval between probes of failed preferred endpoints
+func WithEndpointProbeInterval(interval time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.EndpointProbeInterval = interval
+	})
+}
+
+// WithCredentials sets the access key & secret
+func WithCredentials(accessKey string, accessSecret string) Option {
+	return optionFunc(func(config *Config) {
+		config.AccessKey = accessKey
+		config.AccessSecret = accessSecret
+	})
+}
+
+// WithLogStore sets the log store
+func WithLogStore(logStore string) Option {
+	return optionFunc(func(config *Config) {
+		config.LogStore = logStore
+	})
+}
+
+// WithTopic sets the topic of sent log groups
+func WithTopic(topic string) Option {
+	return optionFunc(func(config *Config) {
+		config.Topic = topic
+	})
+}
+
+// WithTimeout bounds each send, defaults to DefaultTimeout. Set 0 to disable.
+func WithTimeout(timeout time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.Timeout = timeout
+	})
+}
+
+// WithBufferSize sets how many logs are queued before sends block
+func WithBufferSize(size int) Option {
+	return optionFunc(func(config *Config) {
+		config.BufferSize = size
+	})
+}
+
+// WithBufferBytes bounds the encoded size of queued logs
+func WithBufferBytes(size int) Option {
+	return optionFunc(func(config *Config) {
+		config.BufferBytes = size
+	})
+}
+
+// WithOverflowPolicy sets what happens to logs sent when the buffer is full
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return optionFunc(func(config *Config) {
+		config.OverflowPolicy = policy
+	})
+}
+
+// WithLaneWeights sets the logs taken in turn from the high, normal & low priority lanes when batching
+func WithLaneWeights(high int, normal int, low int) Option {
+	return optionFunc(func(config *Config) {
+		config.LaneWeights = [LaneCount]int{high, normal, low}
+	})
+}
+
+// WithMaxBatchSize sets the maximum number of logs in a batch
+func WithMaxBatchSize(size int) Option {
+	return optionFunc(func(config *Config) {
+		config.MaxBatchSize = size
+	})
+}
+
+// WithMaxBatchBytes sets the maximum encoded size of logs in a batch
+func WithMaxBatchBytes(size int) Option {
+	return optionFunc(func(config *Config) {
+		config.MaxBatchBytes = size
+	})
+}
+
+// WithSendInterval sets the interval between batch sends
+func WithSendInterval(interval time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.SendInterval = interval
+	})
+}
+
+// WithLevels sets the logrus levels fired to the hook
+func WithLevels(levels ...logrus.Level) Option {
+	return optionFunc(func(config *Config) {
+		config.Levels = levels
+	})
+}
+
+// WithHTTPClient sets the http client sending requests to sls
+func WithHTTPClient(client *http.Client) Option {
+	return optionFunc(func(config *Config) {
+		config.HTTPClient = client
+	})
+}
+
+// WithTransport sets the transport of the http client, e.g. a test http.RoundTripper
+func WithTransport(transport http.RoundTripper) Option {
+	return optionFunc(func(config *Config) {
+		config.Transport = transport
+	})
+}
+
+// WithProxy sets the url of http, https or socks5 proxy
+func WithProxy(proxyURL string) Option {
+	return optionFunc(func(config *Config) {
+		config.ProxyURL = proxyURL
+	})
+}
+
+// WithTLSConfig sets the tls config of https endpoints
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return optionFunc(func(config *Config) {
+		config.TLSConfig = tlsConfig
+	})
+}
+
+// WithMaxIdleConns sets the connections kept alive to sls
+func WithMaxIdleConns(maxIdleConns int) Option {
+	return optionFunc(func(config *Config) {
+		config.MaxIdleConns = maxIdleConns
+	})
+}
+
+// WithDialTimeout sets the dial timeout & keep alive period of connections
+func WithDialTimeout(dialTimeout time.Duration, keepAlive time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.DialTimeout = dialTimeout
+		config.KeepAlive = keepAlive
+	})
+}
+
+// WithFallback sets where logs go when sls is not available, defaults to stdout
+func WithFallback(fallback FallbackFunc) Option {
+	return optionFunc(func(config *Config) {
+		config.Fallback = fallback
+	})
+}
+
+// WithOversizePolicy sets how logs exceeding MaxLogItemSize are handled
+func WithOversizePolicy(policy OversizePolicy) Option {
+	return optionFunc(func(config *Config) {
+		config.OversizePolicy = policy
+	})
+}
+
+// WithCompression sets the compression of request bodies
+func WithCompression(compression Compression) Option {
+	return optionFunc(func(config *Config) {
+		config.Compression = compression
+	})
+}
+
+// WithMaxRetries sets the retries of a failed send, set a negative value to disable
+func WithMaxRetries(maxRetries int) Option {
+	return optionFunc(func(config *Config) {
+		config.MaxRetries = maxRetries
+	})
+}
+
+// WithContext sets the parent context of every send
+func WithContext(ctx context.Context) Option {
+	return optionFunc(func(config *Config) {
+		config.Context = ctx
+	})
+}
+
+// WithTraceExtractors sets how the trace context is pulled from contexts,
+// tracing is disabled without extractors
+func WithTraceExtractors(extractors ...TraceExtractor) Option {
+	return optionFunc(func(config *Config) {
+		config.TraceExtractors = append([]TraceExtractor{}, extractors...)
+	})
+}
+
+// WithCircuitBreaker opens the circuit breaker after threshold consecutive
+// failed batches, probing again after cooldown. Set a negative threshold to disable.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.BreakerThreshold = threshold
+		config.BreakerCooldown = cooldown
+	})
+}
+
+// WithRateLimit bounds the bytes sent per second as compressed & the requests
+// sent per second, 0 for unlimited. Retries & Producer.Replay yield to live traffic.
+func WithRateLimit(bytesPerSecond int, requestsPerSecond int) Option {
+	return optionFunc(func(config *Config) {
+		config.RateLimitBytes = bytesPerSecond
+		config.RateLimitRequests = requestsPerSecond
+	})
+}
+
+// WithLogTimeCorrection shifts log times by the clock offset detected from sls responses
+func WithLogTimeCorrection() Option {
+	return optionFunc(func(config *Config) {
+		config.CorrectLogTime = true
+	})
+}
+
+// WithFatalFlushTimeout bounds the synchronous flush of fatal & panic logs
+func WithFatalFlushTimeout(timeout time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.FatalFlushTimeout = timeout
+	})
+}
@@ -0,0 +1,82 @@
+package hook_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *testing.T) {
+	server := newServer(t)
+	slsLogrusHook, err := hook.New(
+		hook.WithEndpoint(server.URL),
+		hook.WithCredentials("test", "test"),
+		hook.WithLogStore("test"),
+		hook.WithTopic("test"),
+		hook.WithSendInterval(10*time.Millisecond),
+		hook.WithMaxBatchSize(2),
+		hook.WithLevels(logrus.ErrorLevel, logrus.WarnLevel),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []logrus.Level{logrus.ErrorLevel, logrus.WarnLevel}, slsLogrusHook.Levels())
+
+	logger := logrus.New()
+	logger.AddHook(slsLogrusHook)
+	logger.SetFormatter(&hook.NoopFormatter{})
+	logger.SetOutput(ioutil.Discard)
+	logger.Info("skipped")
+	for i := 0; i < 3; i++ {
+		logger.Warn("sent")
+	}
+	assert.Nil(t, slsLogrusHook.FlushContext(context.Background()))
+	groups := receiveGroups(t, server, 2)
+	assert.Equal(t, 2, len(groups[0].Logs))
+	assert.Equal(t, 1, len(groups[1].Logs))
+}
+
+func TestOptionsFallback(t *testing.T) {
+	server := newServer(t)
+	// Sends time out
+	server.Inject(slstest.Latency(200*time.Millisecond), 0)
+	type fallen struct {
+		contents map[string]string
+		err      error
+	}
+	fallback := make(chan fallen, 1)
+	producer, err := hook.NewProducer(append(server.Options(),
+		hook.WithLogStore("test"),
+		hook.WithTopic("test"),
+		hook.WithTimeout(50*time.Millisecond),
+		hook.WithMaxRetries(-1),
+		hook.WithSendInterval(10*time.Millisecond),
+		hook.WithFallback(func(ctx context.Context, logs []*hook.Log) error {
+			// Logs are reused once the fallback returns
+			assert.Equal(t, 1, len(logs))
+			fallback <- fallen{slstest.Fields(logs[0]), ctx.Err()}
+			return nil
+		}),
+	)...)
+	assert.Nil(t, err)
+	assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"message": "fallback", "user": "alice"}))
+	logs := <-fallback
+	assert.Equal(t, map[string]string{"message": "fallback", "user": "alice"}, logs.contents)
+	// The fallback is not handed the context of the timed out send
+	assert.Nil(t, logs.err)
+}
+
+func TestOptionsValidation(t *testing.T) {
+	_, err := hook.New(
+		hook.WithEndpoint("localhost"),
+		hook.WithBufferSize(-1),
+		hook.WithMaxBatchSize(hook.MaxLogBatchSize+1),
+		hook.WithLevels(logrus.Level(42)),
+	)
+	assert.NotNil(t, err)
+	assert.Equal(t, "Unable to create sls logrus hook: Invalid sls config: access key should not be empty; access secret should not be empty; log store should not be empty; topic should not be empty; buffer size should not be negative; max batch size should be between 0 and 1024; unknown level 42", err.Error())
+}
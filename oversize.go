@@ -0,0 +1,198 @@
+package hook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gogo/protobuf/proto"
+)
+
+// OversizePolicy decides how a single log exceeding MaxLogItemSize is handled
+type OversizePolicy int
+
+// Oversize policies
+const (
+	// OversizeTruncate truncates the largest content values until the log fits (default)
+	OversizeTruncate OversizePolicy = iota
+	// OversizeSplit splits the largest content value into chunk logs sharing a chunk id
+	OversizeSplit
+	// OversizeDump prints the log to stdout instead of sending it
+	OversizeDump
+)
+
+// Metadata keys added to oversized logs
+const (
+	TruncatedKey  = "__truncated__"
+	ChunkIDKey    = "__chunk_id__"
+	ChunkIndexKey = "__chunk_index__"
+	ChunkCountKey = "__chunk_count__"
+)
+
+// Space reserved for metadata contents added to an oversized log
+const oversizeReserve = 256
+
+// fitLog applies the oversize policy to a log exceeding MaxLogItemSize
+func fitLog(log *Log, policy OversizePolicy) []*Log {
+	switch policy {
+	case OversizeSplit:
+		if chunks := splitLog(log, MaxLogItemSize); chunks != nil {
+			return chunks
+		}
+		fallthrough
+	case OversizeTruncate:
+		if truncated := truncateLog(log, MaxLogItemSize); truncated != nil {
+			return []*Log{truncated}
+		}
+	}
+	// Print huge single log to stdout
+	_, _ = fmt.Fprintf(os.Stdout, "[HUGE SLS LOG] %+v\n", log)
+	return nil
+}
+
+// truncateLog shortens the largest content values of log until it fits in limit,
+// recording the original value lengths under TruncatedKey.
+// Returns nil if the log cannot fit even with all values emptied.
+func truncateLog(log *Log, limit int) *Log {
+	reserve := oversizeReserve
+	for {
+		truncated := truncateContents(log, limit-reserve)
+		if truncated == nil {
+			return nil
+		}
+		// The marker grows with the truncated values, shrink them further if it does not fit
+		size := truncated.Size()
+		if size <= limit {
+			return truncated
+		}
+		reserve += size - limit
+	}
+}
+
+// truncatedContent records the original length of a truncated value, by index
+// as keys may repeat
+type truncatedContent struct {
+	Index  int    `json:"index"`
+	Key    string `json:"key"`
+	Length int    `json:"length"`
+}
+
+// truncateContents shortens the largest content values of log until the values
+// fit in limit, then appends the TruncatedKey marker
+func truncateContents(log *Log, limit int) *Log {
+	contents := make([]*LogContent, len(log.Contents))
+	for i, content := range log.Contents {
+		contents[i] = &LogContent{Key: content.Key, Value: content.Value}
+	}
+	truncated := &Log{Time: log.Time, Contents: contents}
+	excess := truncated.Size() - limit
+	lengths := make([]int, len(contents))
+	for i, content := range contents {
+		lengths[i] = len(content.GetValue())
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	// Find the highest cap on value lengths that removes the excess,
+	// so that only the largest values get truncated.
+	maxLen, sum := -1, 0
+	for k := 1; k <= len(lengths); k++ {
+		sum += lengths[k-1]
+		next := 0
+		if k < len(lengths) {
+			next = lengths[k]
+		}
+		if sum-k*next >= excess {
+			maxLen = (sum - excess) / k
+			break
+		}
+	}
+	if maxLen < 0 {
+		return nil
+	}
+	var originals []truncatedContent
+	for i, content := range contents {
+		value := content.GetValue()
+		if len(value) <= maxLen {
+			continue
+		}
+		originals = append(originals, truncatedContent{Index: i, Key: content.GetKey(), Length: len(value)})
+		content.Value = proto.String(value[:runeBoundary(value, maxLen)])
+	}
+	marker, err := json.Marshal(originals)
+	if err != nil {
+		return nil
+	}
+	truncated.Contents = append(truncated.Contents, &LogContent{
+		Key:   proto.String(TruncatedKey),
+		Value: proto.String(string(marker)),
+	})
+	return truncated
+}
+
+// splitLog splits the largest content value of log into chunk logs that fit in limit.
+// Every chunk carries the other contents along with the chunk metadata.
+// Returns nil if the other contents leave no room for chunks.
+func splitLog(log *Log, limit int) []*Log {
+	largest := -1
+	for i, content := range log.Contents {
+		if largest < 0 || len(content.GetValue()) > len(log.Contents[largest].GetValue()) {
+			largest = i
+		}
+	}
+	if largest < 0 {
+		return nil
+	}
+	value := log.Contents[largest].GetValue()
+	base := &Log{Time: log.Time}
+	for i, content := range log.Contents {
+		if i != largest {
+			base.Contents = append(base.Contents, content)
+		}
+	}
+	chunkSize := limit - base.Size() - len(log.Contents[largest].GetKey()) - oversizeReserve
+	if chunkSize < MaxLogItemSize/16 {
+		return nil
+	}
+	var chunks []string
+	for len(value) > 0 {
+		end := len(value)
+		if end > chunkSize {
+			end = runeBoundary(value, chunkSize)
+		}
+		chunks = append(chunks, value[:end])
+		value = value[end:]
+	}
+	id := chunkID()
+	count := proto.String(strconv.Itoa(len(chunks)))
+	logs := make([]*Log, len(chunks))
+	for i, chunk := range chunks {
+		contents := make([]*LogContent, 0, len(log.Contents)+3)
+		contents = append(contents, base.Contents...)
+		contents = append(contents,
+			&LogContent{Key: log.Contents[largest].Key, Value: proto.String(chunk)},
+			&LogContent{Key: proto.String(ChunkIDKey), Value: id},
+			&LogContent{Key: proto.String(ChunkIndexKey), Value: proto.String(strconv.Itoa(i))},
+			&LogContent{Key: proto.String(ChunkCountKey), Value: count},
+		)
+		logs[i] = &Log{Time: log.Time, Contents: contents}
+	}
+	return logs
+}
+
+// runeBoundary moves n back to the nearest utf8 rune start in s
+func runeBoundary(s string, n int) int {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+func chunkID() *string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return proto.String(hex.EncodeToString(b[:]))
+}
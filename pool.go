@@ -0,0 +1,102 @@
+package hook
+
+import (
+	"io"
+	"sync"
+)
+
+// Logs built by the hook are pooled together with their contents. Released
+// logs keep their LogContent objects beyond len(Contents), and the Key, Value
+// and Time pointers are overwritten in place, so that a reused log does not
+// allocate anything but the strings themselves.
+var logPool = sync.Pool{
+	New: func() interface{} {
+		return &Log{Time: new(uint32)}
+	},
+}
+
+func acquireLog(time uint32) *Log {
+	log := logPool.Get().(*Log)
+	*log.Time = time
+	return log
+}
+
+func appendContent(log *Log, key string, value string) {
+	n := len(log.Contents)
+	if n < cap(log.Contents) {
+		if content := log.Contents[:n+1][n]; content != nil {
+			*content.Key = key
+			*content.Value = value
+			log.Contents = log.Contents[:n+1]
+			return
+		}
+	}
+	k, v := key, value
+	log.Contents = append(log.Contents, &LogContent{Key: &k, Value: &v})
+}
+
+func releaseLog(log *Log) {
+	for _, content := range log.Contents {
+		// Do not retain the strings in pool
+		*content.Key = ""
+		*content.Value = ""
+	}
+	log.Contents = log.Contents[:0]
+	logPool.Put(log)
+}
+
+func releaseLogs(logs []*Log) {
+	for i, log := range logs {
+		releaseLog(log)
+		logs[i] = nil
+	}
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+func acquireBuffer(size int) *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	*buf = (*buf)[:size]
+	return buf
+}
+
+func releaseBuffer(buf *[]byte) {
+	bufferPool.Put(buf)
+}
+
+// bodyReader reads a pooled marshal buffer as request body. The http client
+// may keep reading the body after Do returns, so the reader is detached
+// before the buffer is reused.
+type bodyReader struct {
+	lock     sync.Mutex
+	data     []byte
+	detached bool
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.detached {
+		return 0, io.ErrClosedPipe
+	}
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *bodyReader) detach() {
+	r.lock.Lock()
+	r.detached = true
+	r.data = nil
+	r.lock.Unlock()
+}
@@ -0,0 +1,486 @@
+package hook
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Default config for sls producers
+const (
+	BufferSize          = 4096
+	DefaultSendInterval = 300 * time.Millisecond
+	MaxBatchSize        = 300
+
+	DefaultFatalFlushTimeout = 3 * time.Second
+)
+
+// Config for sls client, producer & logrus hook
+type Config struct {
+	Endpoint string
+	// Endpoints failed over in order of preference after Endpoint, e.g. the
+	// intranet, public & accelerated endpoints of a project
+	Endpoints []string
+	// EndpointProbeInterval between probes of failed preferred endpoints,
+	// defaults to DefaultEndpointProbeInterval
+	EndpointProbeInterval time.Duration
+	AccessKey             string
+	AccessSecret          string
+	LogStore              string
+	Topic                 string
+	Timeout               time.Duration
+	OversizePolicy        OversizePolicy
+	// Compression of request bodies, none by default
+	Compression Compression
+	// SendInterval between batch sends, defaults to DefaultSendInterval
+	SendInterval time.Duration
+	// MaxRetries of a failed send, defaults to DefaultMaxRetries if 0. Set a negative value to disable.
+	MaxRetries int
+	// Context is the parent of every send, cancelling it aborts in-flight sends.
+	Context context.Context
+	// TraceExtractors pull the trace context from entry.Context, defaults to
+	// DefaultTraceExtractors if nil. Set an empty slice to disable.
+	TraceExtractors []TraceExtractor
+	// FatalFlushTimeout bounds the synchronous flush of fatal & panic logs,
+	// defaults to DefaultFatalFlushTimeout.
+	FatalFlushTimeout time.Duration
+	// BufferSize of queued logs, defaults to BufferSize
+	BufferSize int
+	// BufferBytes bounds the encoded size of queued logs, unbounded if 0
+	BufferBytes int
+	// OverflowPolicy when either buffer bound is hit, blocking by default
+	OverflowPolicy OverflowPolicy
+	// LaneWeights are the logs taken in turn from the high, normal & low
+	// priority lanes when batching, defaults to DefaultLaneWeights
+	LaneWeights [LaneCount]int
+	// MaxBatchSize of logs sent at once, defaults to MaxBatchSize
+	MaxBatchSize int
+	// MaxBatchBytes bounds the encoded size of logs sent at once, unbounded if 0
+	MaxBatchBytes int
+	// Levels fired to the logrus hook, defaults to logrus.AllLevels
+	Levels []logrus.Level
+	// HTTPClient sends requests to sls, Timeout is ignored & the transport
+	// options are not allowed when set
+	HTTPClient *http.Client
+	// Transport of the http client, the other transport options are not allowed when set
+	Transport http.RoundTripper
+	// ProxyURL of http, https or socks5 proxy, defaults to proxies from environment variables
+	ProxyURL string
+	// TLSConfig for https endpoints, e.g. custom root CAs
+	TLSConfig *tls.Config
+	// MaxIdleConns kept alive to sls, defaults to DefaultMaxIdleConns
+	MaxIdleConns int
+	// DialTimeout of connections, defaults to DefaultDialTimeout
+	DialTimeout time.Duration
+	// KeepAlive period of connections, defaults to DefaultKeepAlive
+	KeepAlive time.Duration
+	// Fallback receives logs failed to send, defaults to dumping to stdout
+	Fallback FallbackFunc
+	// BreakerThreshold of consecutive failed batches opening the circuit breaker,
+	// which fails fast to the fallback. Defaults to DefaultBreakerThreshold, set
+	// a negative value to disable.
+	BreakerThreshold int
+	// BreakerCooldown before an open circuit breaker probes with a single batch,
+	// defaults to DefaultBreakerCooldown
+	BreakerCooldown time.Duration
+	// RateLimitBytes bounds the bytes sent per second as compressed, unlimited if 0
+	RateLimitBytes int
+	// RateLimitRequests bounds the requests sent per second, unlimited if 0
+	RateLimitRequests int
+	// CorrectLogTime shifts log times by the clock offset detected from sls responses
+	CorrectLogTime bool
+}
+
+// FallbackFunc handles logs which are not sent to sls, logs are reused once it returns
+type FallbackFunc func(ctx context.Context, logs []*Log) error
+
+// Producer batches logs and sends them asynchronously through sls client,
+// with retries, fallback to stdout & flush. The logrus hook and the other
+// logger adapters are thin layers over a producer.
+type Producer struct {
+	client       *SlsClient
+	ctx          context.Context
+	timeout      time.Duration
+	sendInterval time.Duration
+	queue        *queue
+	lock         *sync.Mutex
+	started      bool
+	sending      atomic.Bool
+	wake         chan struct{}
+	realSendLogs func(ctx context.Context, logs []*Log) error
+	fallback     FallbackFunc
+	breaker      *breaker
+
+	maxBatchSize   int
+	maxBatchBytes  int
+	correctLogTime bool
+
+	traceExtractors   []TraceExtractor
+	fatalFlushTimeout time.Duration
+}
+
+// NewProducer creates a producer, which falls back to stdout when sls api is
+// not available. The ping error is returned along with the producer.
+func NewProducer(opts ...Option) (*Producer, error) {
+	config := newConfig(opts)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := NewSlsClient(config)
+	if err != nil {
+		return nil, err
+	}
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p := &Producer{
+		client:       client,
+		ctx:          ctx,
+		timeout:      config.Timeout,
+		queue:        newQueue(orDefault(config.BufferSize, BufferSize), config.BufferBytes, config.OverflowPolicy, config.LaneWeights),
+		lock:         &sync.Mutex{},
+		wake:         make(chan struct{}, 1),
+		sendInterval: DefaultSendInterval,
+		fallback:     config.Fallback,
+
+		maxBatchSize:   orDefault(config.MaxBatchSize, MaxBatchSize),
+		maxBatchBytes:  config.MaxBatchBytes,
+		correctLogTime: config.CorrectLogTime,
+
+		traceExtractors:   config.TraceExtractors,
+		fatalFlushTimeout: config.FatalFlushTimeout,
+	}
+	if p.fallback == nil {
+		p.fallback = fallbackSendLogs
+	}
+	if config.BreakerThreshold >= 0 {
+		p.breaker = newBreaker(config.BreakerThreshold, config.BreakerCooldown)
+	}
+	if config.SendInterval > 0 {
+		p.sendInterval = config.SendInterval
+	}
+	if p.fatalFlushTimeout <= 0 {
+		p.fatalFlushTimeout = DefaultFatalFlushTimeout
+	}
+	if p.traceExtractors == nil {
+		p.traceExtractors = DefaultTraceExtractors
+	}
+	err = client.PingContext(ctx)
+	if err != nil {
+		p.realSendLogs = p.fallback
+		_, _ = fmt.Fprintf(os.Stderr, "Fail to send logs to sls, fallback to stdout. error: %v", err.Error())
+	} else {
+		p.realSendLogs = client.SendLogsContext
+	}
+	return p, err
+}
+
+// Stats of a producer
+type Stats struct {
+	// Queued logs in each lane
+	Queued [LaneCount]int
+	// QueuedBytes is the encoded size of queued logs
+	QueuedBytes int
+	// Dropped logs on overflow
+	Dropped uint64
+}
+
+// Stats reports queued & dropped logs
+func (p *Producer) Stats() Stats {
+	var stats Stats
+	p.queue.stats(&stats)
+	return stats
+}
+
+// EndpointStats reports health & served batches of each endpoint, in order of preference
+func (p *Producer) EndpointStats() []EndpointStats {
+	return p.client.EndpointStats()
+}
+
+// ClockOffset of the sls server clock to the local clock
+func (p *Producer) ClockOffset() time.Duration {
+	return p.client.ClockOffset()
+}
+
+// BreakerState of the circuit breaker around sends, closed if disabled
+func (p *Producer) BreakerState() BreakerState {
+	if p.breaker == nil {
+		return BreakerClosed
+	}
+	return p.breaker.State()
+}
+
+// SetSendInterval change batch send interval, which is immutable once the producer starts sending.
+//
+// Deprecated: Use WithSendInterval or Config.SendInterval.
+func (p *Producer) SetSendInterval(interval time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.started {
+		_, _ = fmt.Fprintln(os.Stderr, "Send interval can not be changed once the producer started sending")
+		return
+	}
+	p.sendInterval = interval
+}
+
+// Send queues a copy of log for sending, the log may be reused once Send returns
+func (p *Producer) Send(log *Log) error {
+	return p.SendContext(context.Background(), log)
+}
+
+// SendContext queues a copy of log for sending, giving up when ctx is done
+// before there is room in the buffer
+func (p *Producer) SendContext(ctx context.Context, log *Log) error {
+	return p.send(ctx, copyLog(log))
+}
+
+// SendFatal queues a copy of log & waits up to FatalFlushTimeout until it is
+// flushed, for logs emitted right before the process exits or panics
+func (p *Producer) SendFatal(ctx context.Context, log *Log) error {
+	return p.sendFatal(ctx, copyLog(log))
+}
+
+// copyLog copies log into a pooled log
+func copyLog(log *Log) *Log {
+	queued := acquireLog(log.GetTime())
+	for _, content := range log.Contents {
+		appendContent(queued, content.GetKey(), content.GetValue())
+	}
+	return queued
+}
+
+// SendMap queues a log of the fields at time t for sending
+func (p *Producer) SendMap(t time.Time, fields map[string]string) error {
+	return p.SendMapContext(context.Background(), t, fields)
+}
+
+// SendMapContext queues a log of the fields sorted by key at time t for sending, giving up
+// when ctx is done before there is room in the buffer
+func (p *Producer) SendMapContext(ctx context.Context, t time.Time, fields map[string]string) error {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	// Contents are sorted by key, so that logs are encoded the same way every time
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	log := acquireLog(uint32(t.Unix()))
+	for _, k := range keys {
+		appendContent(log, k, fields[k])
+	}
+	return p.send(ctx, log)
+}
+
+// Flush ensure logs are flush through sls api
+func (p *Producer) Flush(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_ = p.FlushContext(ctx)
+}
+
+// FlushContext waits until queued logs are flushed through sls api,
+// returning ctx.Err() if ctx is done first.
+func (p *Producer) FlushContext(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for p.sending.Load() || p.queue.len() > 0 {
+		// Wake up the worker instead of waiting for the send interval
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Replay sends logs synchronously as replay, e.g. logs dumped by a fallback
+// & read back from a spool. Replay shares the rate limits of the producer,
+// yielding to live logs. Logs may be reused once Replay returns.
+func (p *Producer) Replay(ctx context.Context, logs []*Log) error {
+	ctx = ContextWithReplay(ctx)
+	for len(logs) > 0 {
+		n := len(logs)
+		if n > MaxLogBatchSize {
+			n = MaxLogBatchSize
+		}
+		if err := p.client.SendLogsContext(ctx, logs[:n]); err != nil {
+			return err
+		}
+		logs = logs[n:]
+	}
+	return nil
+}
+
+// sendFatal queues a pooled log & flushes synchronously, as the process is about to exit or panic
+func (p *Producer) sendFatal(ctx context.Context, log *Log) error {
+	if err := p.send(ctx, log); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.fatalFlushTimeout)
+	defer cancel()
+	return p.FlushContext(ctx)
+}
+
+// send queues a pooled log, giving up when ctx is done before there is room in the buffer
+func (p *Producer) send(ctx context.Context, log *Log) error {
+	if err := p.queue.push(ctx, log); err != nil {
+		return err
+	}
+	if !p.sending.Load() {
+		p.startWork()
+	}
+	return nil
+}
+
+func (p *Producer) startWork() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.sending.Load() {
+		return
+	}
+	p.started = true
+	p.sending.Store(true)
+	go p.work()
+}
+
+func (p *Producer) work() {
+	batch := make([]*Log, p.maxBatchSize)
+	// pending is a log popped which did not fit in the previous batch
+	var pending *Log
+	var pendingSize int
+	for {
+		deadline := time.NewTimer(p.sendInterval)
+		p.queue.rewind()
+		logs := batch
+		count, size := 0, 0
+		flushing := false
+		add := func(log *Log, logSize int) bool {
+			if p.maxBatchBytes > 0 && count > 0 && size+logSize > p.maxBatchBytes {
+				// Only a single oversized log exceeds the bound
+				pending, pendingSize = log, logSize
+				return false
+			}
+			logs[count] = log
+			count++
+			size += logSize
+			return p.maxBatchBytes <= 0 || size < p.maxBatchBytes
+		}
+		if pending != nil {
+			log := pending
+			pending = nil
+			add(log, pendingSize)
+		}
+	waitLoop:
+		for count < p.maxBatchSize {
+			if log, logSize := p.queue.pop(); log != nil {
+				if !add(log, logSize) {
+					break waitLoop
+				}
+				continue
+			}
+			if flushing {
+				// Send whatever is queued right away
+				break waitLoop
+			}
+			select {
+			case <-p.queue.ready:
+			case <-p.wake:
+				flushing = true
+			case <-deadline.C:
+				break waitLoop
+			}
+		}
+		deadline.Stop()
+		if count == 0 {
+			idle := time.NewTimer(p.sendInterval)
+			select {
+			case <-idle.C:
+			case <-p.wake:
+			}
+			idle.Stop()
+			if p.queue.len() == 0 {
+				break
+			}
+			continue
+		}
+		logs = logs[0:count]
+		p.sendBatch(logs)
+		releaseLogs(logs)
+	}
+	p.sending.Store(false)
+	// if new logs pushed to queue before setting sending to false.
+	if p.queue.len() > 0 {
+		p.startWork()
+	}
+}
+
+// sendBatch sends logs within the per-send deadline, dumping them to stdout on failure
+func (p *Producer) sendBatch(logs []*Log) {
+	ctx := p.ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	if p.correctLogTime {
+		if offset := int64(p.client.ClockOffset() / time.Second); offset != 0 {
+			for _, log := range logs {
+				*log.Time = uint32(int64(log.GetTime()) + offset)
+			}
+		}
+	}
+	if p.breaker != nil && !p.breaker.allow() {
+		p.fallBack(logs)
+		return
+	}
+	err := p.realSendLogs(ctx, logs)
+	if p.breaker != nil && p.breaker.done(err != nil && breakerFailure(err)) {
+		_, _ = fmt.Fprintf(os.Stderr, "Sls circuit breaker opened, falling back for %v\n", p.breaker.cooldown)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error sending logs, error: %+v\n", err)
+		p.fallBack(logs)
+	}
+}
+
+// fallBack hands logs to the fallback within a deadline of its own, as the send
+// context is done once the send timed out or Config.Context is cancelled
+func (p *Producer) fallBack(logs []*Log) {
+	ctx := context.WithoutCancel(p.ctx)
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	_ = p.fallback(ctx, logs)
+}
+
+func orDefault(value int, defaultValue int) int {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func fallbackSendLogs(_ context.Context, logs []*Log) error {
+	for _, log := range logs {
+		_, _ = fmt.Fprint(os.Stdout, log, "\n")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package hook_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducer(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	log := &hook.Log{
+		Time: proto.Uint32(1560000000),
+		Contents: []*hook.LogContent{
+			{Key: proto.String("event"), Value: proto.String("login")},
+			{Key: proto.String("user"), Value: proto.String("alice")},
+		},
+	}
+	assert.Nil(t, producer.Send(log))
+	// The producer sends a copy
+	log.Contents[1].Value = proto.String("bob")
+	assert.Nil(t, producer.SendMap(time.Unix(1560000001, 0), map[string]string{"metric": "latency"}))
+	assert.Nil(t, producer.FlushContext(context.Background()))
+
+	logs := server.Wait(time.Second, 2)
+	if !assert.Equal(t, 2, len(logs)) {
+		return
+	}
+	for _, received := range server.Received() {
+		assert.Equal(t, "test", received.Group.GetTopic())
+	}
+	assert.Equal(t, uint32(1560000000), logs[0].GetTime())
+	assert.Equal(t, "event", logs[0].Contents[0].GetKey())
+	assert.Equal(t, "login", logs[0].Contents[0].GetValue())
+	assert.Equal(t, "alice", logs[0].Contents[1].GetValue())
+	assert.Equal(t, uint32(1560000001), logs[1].GetTime())
+	assert.Equal(t, "metric", logs[1].Contents[0].GetKey())
+	assert.Equal(t, "latency", logs[1].Contents[0].GetValue())
+}
+
+func TestMaxBatchBytes(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server, hook.WithMaxBatchBytes(1000))
+
+	sizes := []int{600, 600, 300, 600, 1500, 100}
+	for _, size := range sizes {
+		assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"message": strings.Repeat("m", size)}))
+	}
+	assert.Nil(t, producer.FlushContext(context.Background()))
+
+	receiveLogs(t, server, len(sizes))
+	var batches [][]int
+	for _, received := range server.Received() {
+		group := received.Group
+		var batch []int
+		size := 0
+		for _, log := range group.Logs {
+			message, _ := slstest.Value(log, "message")
+			batch = append(batch, len(message))
+			size += log.Size()
+		}
+		// Only a single oversized log exceeds the bound
+		assert.True(t, size <= 1000 || len(group.Logs) == 1)
+		batches = append(batches, batch)
+	}
+	assert.Equal(t, [][]int{{600}, {600, 300}, {600}, {1500}, {100}}, batches)
+}
@@ -0,0 +1,259 @@
+package hook
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Lane of queued logs by level class, drained by weight
+type Lane int
+
+// Lanes in order of priority
+const (
+	// LaneHigh queues WARNING & more severe logs
+	LaneHigh Lane = iota
+	// LaneNormal queues INFO logs & logs without a level
+	LaneNormal
+	// LaneLow queues DEBUG & TRACE logs
+	LaneLow
+	// LaneCount is the number of lanes
+	LaneCount
+)
+
+// DefaultLaneWeights are the logs taken from each lane in turn when batching
+var DefaultLaneWeights = [LaneCount]int{8, 3, 1}
+
+// OverflowPolicy decides what happens to logs sent when the queue is full
+type OverflowPolicy int
+
+// Overflow policies
+const (
+	// OverflowBlock blocks sends until there is room or the context is done
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropLow drops the oldest log of the lowest priority lane, or the
+	// sent log if none queued is less important
+	OverflowDropLow
+)
+
+// laneOf classifies a log by its level content
+func laneOf(log *Log) Lane {
+	for _, content := range log.Contents {
+		if content.GetKey() != "level" {
+			continue
+		}
+		level := content.GetValue()
+		for _, high := range [...]string{"ERROR", "WARNING", "WARN", "FATAL", "PANIC"} {
+			if strings.EqualFold(level, high) {
+				return LaneHigh
+			}
+		}
+		if strings.EqualFold(level, "DEBUG") || strings.EqualFold(level, "TRACE") {
+			return LaneLow
+		}
+		return LaneNormal
+	}
+	return LaneNormal
+}
+
+// queued log with its encoded size
+type queued struct {
+	log  *Log
+	size int
+}
+
+// ring is a fifo of logs
+type ring struct {
+	logs  []queued
+	head  int
+	n     int
+	bytes int
+}
+
+func (r *ring) push(log *Log, size int) {
+	if r.n == len(r.logs) {
+		logs := make([]queued, 2*len(r.logs)+16)
+		for i := 0; i < r.n; i++ {
+			logs[i] = r.logs[(r.head+i)%len(r.logs)]
+		}
+		r.logs, r.head = logs, 0
+	}
+	r.logs[(r.head+r.n)%len(r.logs)] = queued{log, size}
+	r.n++
+	r.bytes += size
+}
+
+func (r *ring) pop() queued {
+	q := r.logs[r.head]
+	r.logs[r.head] = queued{}
+	r.head = (r.head + 1) % len(r.logs)
+	r.n--
+	r.bytes -= q.size
+	return q
+}
+
+// queue of logs in priority lanes bounded by capacity, and by a budget of
+// encoded bytes if positive
+type queue struct {
+	lock     sync.Mutex
+	lanes    [LaneCount]ring
+	count    int
+	bytes    int
+	capacity int
+	budget   int
+	policy   OverflowPolicy
+	weights  [LaneCount]int
+	dropped  uint64
+	// weighted draining state
+	lane Lane
+	used int
+	// ready is signalled on push, space on pop
+	ready chan struct{}
+	space chan struct{}
+}
+
+func newQueue(capacity int, budget int, policy OverflowPolicy, weights [LaneCount]int) *queue {
+	for lane := range weights {
+		if weights[lane] <= 0 {
+			weights[lane] = DefaultLaneWeights[lane]
+		}
+	}
+	return &queue{
+		capacity: capacity,
+		budget:   budget,
+		policy:   policy,
+		weights:  weights,
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// fits tells whether a log of size fits in the queue after count logs of bytes are removed.
+// A log exceeding the budget fits in an empty queue.
+func (q *queue) fits(size int, count int, bytes int) bool {
+	if q.count-count >= q.capacity {
+		return false
+	}
+	return q.budget <= 0 || q.count == count || q.bytes-bytes+size <= q.budget
+}
+
+// push queues a pooled log by the overflow policy, which is released when
+// dropped or ctx is done before there is room
+func (q *queue) push(ctx context.Context, log *Log) error {
+	lane := laneOf(log)
+	size := log.Size()
+	for {
+		q.lock.Lock()
+		if q.fits(size, 0, 0) {
+			q.add(lane, log, size)
+			room := q.count < q.capacity && (q.budget <= 0 || q.bytes < q.budget)
+			q.lock.Unlock()
+			if room {
+				// Pass the space signal on to other blocked senders
+				notify(q.space)
+			}
+			notify(q.ready)
+			return nil
+		}
+		if q.policy == OverflowDropLow {
+			q.dropLow(lane, log, size)
+			q.lock.Unlock()
+			notify(q.ready)
+			return nil
+		}
+		q.lock.Unlock()
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			releaseLog(log)
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *queue) add(lane Lane, log *Log, size int) {
+	q.lanes[lane].push(log, size)
+	q.count++
+	q.bytes += size
+}
+
+// dropLow makes room for log by dropping the oldest logs of lower priority
+// lanes, or drops log if that is not enough
+func (q *queue) dropLow(lane Lane, log *Log, size int) {
+	count, bytes := 0, 0
+	for lower := lane + 1; lower < LaneCount; lower++ {
+		count += q.lanes[lower].n
+		bytes += q.lanes[lower].bytes
+	}
+	if !q.fits(size, count, bytes) {
+		q.dropped++
+		releaseLog(log)
+		return
+	}
+	for lowest := LaneCount - 1; !q.fits(size, 0, 0); {
+		if q.lanes[lowest].n == 0 {
+			lowest--
+			continue
+		}
+		dropped := q.lanes[lowest].pop()
+		q.count--
+		q.bytes -= dropped.size
+		q.dropped++
+		releaseLog(dropped.log)
+	}
+	q.add(lane, log, size)
+}
+
+// pop takes the next log & its encoded size by weighted
+// draining of lanes. Returns nil if empty.
+func (q *queue) pop() (*Log, int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.count == 0 {
+		return nil, 0
+	}
+	for {
+		if q.lanes[q.lane].n > 0 && q.used < q.weights[q.lane] {
+			q.used++
+			popped := q.lanes[q.lane].pop()
+			q.count--
+			q.bytes -= popped.size
+			notify(q.space)
+			return popped.log, popped.size
+		}
+		q.lane = (q.lane + 1) % LaneCount
+		q.used = 0
+	}
+}
+
+// rewind starts weighted draining again from the high priority lane, so that
+// each batch begins with the most severe logs
+func (q *queue) rewind() {
+	q.lock.Lock()
+	q.lane, q.used = LaneHigh, 0
+	q.lock.Unlock()
+}
+
+func (q *queue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.count
+}
+
+// stats fills the queue part of producer stats
+func (q *queue) stats(stats *Stats) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for lane := range q.lanes {
+		stats.Queued[lane] = q.lanes[lane].n
+	}
+	stats.QueuedBytes = q.bytes
+	stats.Dropped = q.dropped
+}
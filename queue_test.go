@@ -0,0 +1,106 @@
+package hook_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func groupMessages(group *hook.LogGroup) []string {
+	var messages []string
+	for _, log := range group.Logs {
+		message, _ := slstest.Value(log, "message")
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func TestPriorityLanes(t *testing.T) {
+	server := newServer(t)
+	transport, started, release := blockFirstPost()
+	producer := newTestProducer(t, server,
+		hook.WithTransport(transport),
+		hook.WithBufferSize(3),
+		hook.WithOverflowPolicy(hook.OverflowDropLow),
+	)
+	send := func(level string, message string) {
+		assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"level": level, "message": message}))
+	}
+
+	// Keep the worker busy with the first batch
+	send("INFO", "first")
+	<-started
+	send("DEBUG", "debug 1")
+	send("DEBUG", "debug 2")
+	send("INFO", "info")
+	// The oldest DEBUG log makes room for the ERROR log
+	send("ERROR", "error")
+	// DEBUG logs are dropped as no queued log is less important
+	send("DEBUG", "debug 3")
+	stats := producer.Stats()
+	assert.Equal(t, [hook.LaneCount]int{1, 1, 1}, stats.Queued)
+	assert.Equal(t, uint64(2), stats.Dropped)
+
+	close(release)
+	assert.Nil(t, producer.FlushContext(context.Background()))
+	groups := receiveGroups(t, server, 2)
+	assert.Equal(t, []string{"first"}, groupMessages(groups[0]))
+	assert.Equal(t, []string{"error", "info", "debug 2"}, groupMessages(groups[1]))
+}
+
+func TestLaneWeights(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server,
+		hook.WithSendInterval(time.Hour),
+		hook.WithLaneWeights(2, 1, 1),
+	)
+	for _, level := range []string{"DEBUG", "DEBUG", "INFO", "INFO", "WARNING", "WARNING", "WARNING", "ERROR"} {
+		assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"level": level}))
+	}
+	assert.Nil(t, producer.FlushContext(context.Background()))
+	var levels []string
+	for _, log := range receiveGroups(t, server, 1)[0].Logs {
+		level, _ := slstest.Value(log, "level")
+		levels = append(levels, level)
+	}
+	assert.Equal(t, []string{"WARNING", "WARNING", "INFO", "DEBUG", "WARNING", "ERROR", "INFO", "DEBUG"}, levels)
+}
+
+func TestBufferBytes(t *testing.T) {
+	server := newServer(t)
+	transport, started, release := blockFirstPost()
+	producer := newTestProducer(t, server,
+		hook.WithTransport(transport),
+		hook.WithBufferBytes(3000),
+		hook.WithOverflowPolicy(hook.OverflowDropLow),
+	)
+	send := func(level string, message string, size int) {
+		assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"level": level, "message": message, "stack": strings.Repeat("s", size)}))
+	}
+
+	send("INFO", "first", 0)
+	<-started
+	send("DEBUG", "debug 1", 1000)
+	send("DEBUG", "debug 2", 1000)
+	assert.True(t, producer.Stats().QueuedBytes > 2000)
+	// Both DEBUG logs make room for the ERROR log
+	send("ERROR", "error", 2000)
+	// Only less important logs are dropped
+	send("ERROR", "error 2", 2000)
+	stats := producer.Stats()
+	assert.Equal(t, [hook.LaneCount]int{1, 0, 0}, stats.Queued)
+	assert.Equal(t, uint64(3), stats.Dropped)
+	assert.True(t, stats.QueuedBytes > 2000 && stats.QueuedBytes < 3000)
+
+	close(release)
+	assert.Nil(t, producer.FlushContext(context.Background()))
+	groups := receiveGroups(t, server, 2)
+	assert.Equal(t, []string{"first"}, groupMessages(groups[0]))
+	assert.Equal(t, []string{"error"}, groupMessages(groups[1]))
+	assert.Equal(t, 0, producer.Stats().QueuedBytes)
+}
@@ -0,0 +1,168 @@
+package hook
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/innopals/sls-logrus-hook/internal/field"
+)
+
+// SlogHandler implements slog.Handler, sending records through a producer
+type SlogHandler struct {
+	producer *Producer
+	opts     slog.HandlerOptions
+	// contents preformatted from WithAttrs
+	contents []*LogContent
+	// groups opened with WithGroup
+	groups []string
+	prefix string
+}
+
+// SlogHandler creates a slog.Handler sharing the queue & sls client of the hook
+func (hook *SlsLogrusHook) SlogHandler(opts *slog.HandlerOptions) *SlogHandler {
+	return hook.producer.SlogHandler(opts)
+}
+
+// SlogHandler creates a slog.Handler sending records through the producer.
+// Source locations are added unless opts.AddSource is false on non-nil opts.
+func (p *Producer) SlogHandler(opts *slog.HandlerOptions) *SlogHandler {
+	handler := &SlogHandler{
+		producer: p,
+		opts:     slog.HandlerOptions{AddSource: true},
+	}
+	if opts != nil {
+		handler.opts = *opts
+	}
+	return handler
+}
+
+// Enabled implements slog.Handler
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle implements slog.Handler
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	t := record.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	log := acquireLog(uint32(t.Unix()))
+	appendContent(log, "level", slogLevelName(record.Level))
+	if h.opts.AddSource && record.PC != 0 {
+		appendContent(log, "location", cachedLocation(record.PC).location)
+	}
+	appendContent(log, "message", record.Message)
+	if traceContext, ok := extractTrace(ctx, h.producer.traceExtractors); ok {
+		appendTrace(log, traceContext)
+	}
+	for _, content := range h.contents {
+		appendContent(log, content.GetKey(), content.GetValue())
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		h.appendAttr(log, h.groups, h.prefix, attr)
+		return true
+	})
+	return h.producer.send(context.Background(), log)
+}
+
+// WithAttrs implements slog.Handler
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	// Format attrs once into a scratch log, they are copied into every record
+	scratch := &Log{}
+	for _, attr := range attrs {
+		h.appendAttr(scratch, h.groups, h.prefix, attr)
+	}
+	handler := *h
+	handler.contents = make([]*LogContent, 0, len(h.contents)+len(scratch.Contents))
+	handler.contents = append(handler.contents, h.contents...)
+	handler.contents = append(handler.contents, scratch.Contents...)
+	return &handler
+}
+
+// WithGroup implements slog.Handler, attrs of the group are added with dotted keys
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	handler := *h
+	handler.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	handler.prefix = h.prefix + name + "."
+	return &handler
+}
+
+func (h *SlogHandler) appendAttr(log *Log, groups []string, prefix string, attr slog.Attr) {
+	if h.opts.ReplaceAttr != nil && attr.Value.Kind() != slog.KindGroup {
+		attr = h.opts.ReplaceAttr(groups, attr)
+	}
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		group := value.Group()
+		if len(attr.Key) > 0 {
+			groups = append(groups[:len(groups):len(groups)], attr.Key)
+			prefix = prefix + attr.Key + "."
+		}
+		for _, attr := range group {
+			h.appendAttr(log, groups, prefix, attr)
+		}
+		return
+	}
+	if len(attr.Key) == 0 {
+		return
+	}
+	if value.Kind() == slog.KindAny {
+		if err, ok := value.Any().(error); ok && err != nil {
+			appendError(log, field.Key(prefix+attr.Key), err)
+			return
+		}
+	}
+	if formatted := formatSlogValue(value); len(formatted) > 0 {
+		appendContent(log, field.Key(prefix+attr.Key), formatted)
+	}
+}
+
+func formatSlogValue(value slog.Value) string {
+	switch value.Kind() {
+	case slog.KindString:
+		return value.String()
+	case slog.KindInt64:
+		return strconv.FormatInt(value.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.FormatUint(value.Uint64(), 10)
+	case slog.KindFloat64:
+		return strconv.FormatFloat(value.Float64(), 'g', -1, 64)
+	case slog.KindBool:
+		return strconv.FormatBool(value.Bool())
+	case slog.KindDuration:
+		return value.Duration().String()
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	default:
+		return field.Format(value.Any())
+	}
+}
+
+// slogLevelName names slog levels the same as logrus levels
+func slogLevelName(level slog.Level) string {
+	switch {
+	case level < slog.LevelDebug:
+		return "TRACE"
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < slog.LevelWarn:
+		return "INFO"
+	case level < slog.LevelError:
+		return "WARNING"
+	default:
+		return "ERROR"
+	}
+}
@@ -0,0 +1,48 @@
+package hook_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	server := newServer(t)
+	slsLogrusHook := hook.NewHookWithProducer(newTestProducer(t, server))
+
+	handler := slsLogrusHook.SlogHandler(&slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true})
+	assert.False(t, handler.Enabled(context.Background(), slog.LevelDebug-1))
+	assert.True(t, handler.Enabled(context.Background(), slog.LevelDebug))
+
+	logger := slog.New(handler)
+	ctx := hook.ContextWithTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	logger.With("service", "test").WithGroup("request").With("id", 42).WarnContext(ctx, "Hello slog!",
+		"elapsed", 1500*time.Millisecond,
+		slog.Group("user", "name", "alice", "admin", true),
+		"message", "conflict",
+	)
+	assert.Nil(t, slsLogrusHook.FlushContext(context.Background()))
+
+	group := receiveGroups(t, server, 1)[0]
+	assert.Equal(t, 1, len(group.Logs))
+	log := group.Logs[0]
+	contents := make(map[string]string)
+	for _, content := range log.Contents {
+		contents[content.GetKey()] = content.GetValue()
+	}
+	assert.Equal(t, "level", log.Contents[0].GetKey())
+	assert.Equal(t, "WARNING", contents["level"])
+	assert.Contains(t, contents["location"], "slog_test.go")
+	assert.Equal(t, "Hello slog!", contents["message"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", contents["trace_id"])
+	assert.Equal(t, "test", contents["service"])
+	assert.Equal(t, "42", contents["request.id"])
+	assert.Equal(t, "1.5s", contents["request.elapsed"])
+	assert.Equal(t, "alice", contents["request.user.name"])
+	assert.Equal(t, "true", contents["request.user.admin"])
+	assert.Equal(t, "conflict", contents["request.message"])
+}
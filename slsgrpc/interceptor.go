@@ -0,0 +1,322 @@
+// Package slsgrpc provides grpc interceptors sending one log per rpc to sls
+package slsgrpc
+
+import (
+	"context"
+	"io"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Default config for grpc interceptors
+const (
+	DefaultMaxPayloadSize = 4 * 1024
+)
+
+// LevelFunc decides the log level of a rpc by its status code
+type LevelFunc func(code codes.Code) string
+
+// DefaultLevel logs client errors as INFO, failures worth a look as WARNING
+// and server failures as ERROR.
+func DefaultLevel(code codes.Code) string {
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.Unauthenticated:
+		return "INFO"
+	case codes.DeadlineExceeded, codes.PermissionDenied, codes.ResourceExhausted, codes.FailedPrecondition, codes.Aborted, codes.OutOfRange:
+		return "WARNING"
+	default:
+		return "ERROR"
+	}
+}
+
+type options struct {
+	level          LevelFunc
+	logPayload     bool
+	maxPayloadSize int
+	redactedFields map[string]bool
+}
+
+// Option configures the interceptors
+type Option func(*options)
+
+// WithLevel sets the level func, defaults to DefaultLevel
+func WithLevel(level LevelFunc) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithPayload logs request & response payloads as json, truncated to maxSize
+// bytes, DefaultMaxPayloadSize if not positive.
+func WithPayload(maxSize int) Option {
+	return func(o *options) {
+		o.logPayload = true
+		o.maxPayloadSize = maxSize
+	}
+}
+
+// WithRedactedFields replaces the values of payload fields with the given json names
+func WithRedactedFields(names ...string) Option {
+	return func(o *options) {
+		for _, name := range names {
+			o.redactedFields[name] = true
+		}
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		level:          DefaultLevel,
+		redactedFields: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.maxPayloadSize <= 0 {
+		o.maxPayloadSize = DefaultMaxPayloadSize
+	}
+	return o
+}
+
+// call collects what is logged of a rpc
+type call struct {
+	kind         string
+	fullMethod   string
+	start        time.Time
+	requests     int
+	responses    int
+	requestSize  int
+	responseSize int
+	request      interface{}
+	response     interface{}
+}
+
+func (c *call) addRequest(msg interface{}) {
+	c.requests++
+	c.requestSize += messageSize(msg)
+	if c.request == nil {
+		c.request = msg
+	}
+}
+
+func (c *call) addResponse(msg interface{}) {
+	c.responses++
+	c.responseSize += messageSize(msg)
+	if c.response == nil {
+		c.response = msg
+	}
+}
+
+func (o *options) send(ctx context.Context, producer *hook.Producer, c *call, err error) {
+	code := status.Code(err)
+	service, method := path.Split(c.fullMethod)
+	log := &hook.Log{Time: new(uint32)}
+	*log.Time = uint32(c.start.Unix())
+	add := func(key string, value string) {
+		k, v := key, value
+		log.Contents = append(log.Contents, &hook.LogContent{Key: &k, Value: &v})
+	}
+	add("level", o.level(code))
+	add("message", "finished "+c.kind+" call "+c.fullMethod+" with code "+code.String())
+	add("grpc.kind", c.kind)
+	add("grpc.service", path.Clean(service)[1:])
+	add("grpc.method", method)
+	add("grpc.full_method", c.fullMethod)
+	add("grpc.code", code.String())
+	add("grpc.time_ms", strconv.FormatFloat(float64(time.Since(c.start))/float64(time.Millisecond), 'f', 3, 64))
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		add("peer.address", p.Addr.String())
+	}
+	add("grpc.request_count", strconv.Itoa(c.requests))
+	add("grpc.request_size", strconv.Itoa(c.requestSize))
+	add("grpc.response_count", strconv.Itoa(c.responses))
+	add("grpc.response_size", strconv.Itoa(c.responseSize))
+	if err != nil {
+		add("error", status.Convert(err).Message())
+	}
+	if o.logPayload {
+		if c.request != nil {
+			add("grpc.request", o.payload(c.request))
+		}
+		if c.response != nil {
+			add("grpc.response", o.payload(c.response))
+		}
+	}
+	if traceContext, ok := producer.TraceContext(ctx); ok {
+		add(hook.TraceIDKey, traceContext.TraceID)
+		add(hook.SpanIDKey, traceContext.SpanID)
+		if len(traceContext.TraceFlags) > 0 {
+			add(hook.TraceFlagsKey, traceContext.TraceFlags)
+		}
+	}
+	_ = producer.Send(log)
+}
+
+func messageSize(msg interface{}) int {
+	if message, ok := msg.(proto.Message); ok {
+		return proto.Size(message)
+	}
+	return 0
+}
+
+// UnaryServerInterceptor logs unary rpcs handled by the server
+func UnaryServerInterceptor(producer *hook.Producer, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		c := &call{kind: "server unary", fullMethod: info.FullMethod, start: time.Now()}
+		c.addRequest(req)
+		resp, err := handler(ctx, req)
+		if err == nil {
+			c.addResponse(resp)
+		}
+		o.send(ctx, producer, c, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs streaming rpcs handled by the server
+func StreamServerInterceptor(producer *hook.Producer, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		c := &call{kind: "server stream", fullMethod: info.FullMethod, start: time.Now()}
+		err := handler(srv, &serverStream{ServerStream: stream, call: c})
+		o.send(stream.Context(), producer, c, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor logs unary rpcs invoked by the client
+func UnaryClientInterceptor(producer *hook.Producer, opts ...Option) grpc.UnaryClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		c := &call{kind: "client unary", fullMethod: method, start: time.Now()}
+		var p peer.Peer
+		c.addRequest(req)
+		err := invoker(ctx, method, req, reply, cc, append(callOpts, grpc.Peer(&p))...)
+		if err == nil {
+			c.addResponse(reply)
+		}
+		o.send(peer.NewContext(ctx, &p), producer, c, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor logs streaming rpcs invoked by the client, once the stream ends
+func StreamClientInterceptor(producer *hook.Producer, opts ...Option) grpc.StreamClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		c := &call{kind: "client stream", fullMethod: method, start: time.Now()}
+		stream, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			o.send(ctx, producer, c, err)
+			return nil, err
+		}
+		cs := &clientStream{ClientStream: stream, call: c, done: func(err error) {
+			// The stream context carries the peer, unlike ctx
+			logCtx := ctx
+			if p, ok := peer.FromContext(stream.Context()); ok {
+				logCtx = peer.NewContext(ctx, p)
+			}
+			o.send(logCtx, producer, c, err)
+		}}
+		// Streams abandoned by the caller are logged once ctx is done, grpc cancels
+		// the stream context itself when the stream ends
+		cs.stop = context.AfterFunc(ctx, func() {
+			cs.finish(status.FromContextError(ctx.Err()).Err())
+		})
+		cs.serverStreams = desc.ServerStreams
+		return cs, nil
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	call *call
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.call.addRequest(m)
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.call.addResponse(m)
+	}
+	return err
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	stop          func() bool
+	done          func(err error)
+	// lock guards call & finished, as ctx may finish the stream concurrently
+	lock     sync.Mutex
+	call     *call
+	finished bool
+}
+
+func (s *clientStream) finish(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.finished {
+		s.finished = true
+		s.stop()
+		s.done(err)
+	}
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	switch {
+	case err == nil:
+		s.lock.Lock()
+		s.call.addRequest(m)
+		s.lock.Unlock()
+	case err != io.EOF:
+		// io.EOF means the stream ended, with the status returned by RecvMsg
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.lock.Lock()
+		s.call.addResponse(m)
+		s.lock.Unlock()
+		if !s.serverStreams {
+			// grpc finishes streams without server streaming after the single response
+			s.finish(nil)
+		}
+	case err == io.EOF:
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package slsgrpc_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slsgrpc"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newProducer creates a producer sending to a sls server, along with a func
+// waiting for the next log received by the server
+func newProducer(t *testing.T) (*hook.Producer, func() map[string]string) {
+	server := slstest.NewServer("test", "test")
+	t.Cleanup(server.Close)
+	producer, err := hook.NewProducer(append(server.Options(),
+		hook.WithLogStore("test"),
+		hook.WithTopic("test"),
+		hook.WithSendInterval(10*time.Millisecond),
+	)...)
+	assert.Nil(t, err)
+	received := 0
+	receive := func() map[string]string {
+		received++
+		logs := server.Wait(time.Second, received)
+		if len(logs) < received {
+			t.Fatal("Sls server should have received a log")
+		}
+		return slstest.Fields(logs[received-1])
+	}
+	return producer, receive
+}
+
+// collectDesc is a client streaming service counting health check requests
+var collectDesc = grpc.ServiceDesc{
+	ServiceName: "test.Collector",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Collect",
+		ClientStreams: true,
+		Handler: func(_ interface{}, stream grpc.ServerStream) error {
+			for {
+				err := stream.RecvMsg(new(healthpb.HealthCheckRequest))
+				if err == io.EOF {
+					return stream.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+				}
+				if err != nil {
+					return err
+				}
+			}
+		},
+	}},
+}
+
+func TestInterceptors(t *testing.T) {
+	producer, receive := newProducer(t)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(slsgrpc.UnaryServerInterceptor(producer, slsgrpc.WithPayload(0), slsgrpc.WithRedactedFields("service"))),
+		grpc.StreamInterceptor(slsgrpc.StreamServerInterceptor(producer)),
+	)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("test", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	server.RegisterService(&collectDesc, struct{}{})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(slsgrpc.UnaryClientInterceptor(producer, slsgrpc.WithLevel(func(codes.Code) string { return "DEBUG" }))),
+		grpc.WithStreamInterceptor(slsgrpc.StreamClientInterceptor(producer)),
+	)
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	serverLog := receive()
+	assert.Equal(t, "INFO", serverLog["level"])
+	assert.Equal(t, "server unary", serverLog["grpc.kind"])
+	assert.Equal(t, "grpc.health.v1.Health", serverLog["grpc.service"])
+	assert.Equal(t, "Check", serverLog["grpc.method"])
+	assert.Equal(t, "/grpc.health.v1.Health/Check", serverLog["grpc.full_method"])
+	assert.Equal(t, "OK", serverLog["grpc.code"])
+	assert.Equal(t, "bufconn", serverLog["peer.address"])
+	assert.Equal(t, "6", serverLog["grpc.request_size"])
+	assert.Equal(t, "2", serverLog["grpc.response_size"])
+	assert.Equal(t, `{"service":"[REDACTED]"}`, serverLog["grpc.request"])
+	assert.Equal(t, `{"status":"SERVING"}`, serverLog["grpc.response"])
+	assert.Contains(t, serverLog, "grpc.time_ms")
+
+	clientLog := receive()
+	assert.Equal(t, "DEBUG", clientLog["level"])
+	assert.Equal(t, "client unary", clientLog["grpc.kind"])
+	assert.Equal(t, "OK", clientLog["grpc.code"])
+	assert.NotContains(t, clientLog, "grpc.request")
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	serverLog = receive()
+	assert.Equal(t, "NotFound", serverLog["grpc.code"])
+	assert.Equal(t, "unknown service", serverLog["error"])
+	assert.Equal(t, "0", serverLog["grpc.response_count"])
+	receive()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "test"})
+	assert.Nil(t, err)
+	update, err := stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, update.Status)
+	cancel()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	// Server & client streams finish concurrently
+	streamLogs := make(map[string]map[string]string)
+	for i := 0; i < 2; i++ {
+		log := receive()
+		streamLogs[log["grpc.kind"]] = log
+	}
+	for _, kind := range []string{"client stream", "server stream"} {
+		log := streamLogs[kind]
+		assert.Equal(t, "Watch", log["grpc.method"], kind)
+		assert.Equal(t, "Canceled", log["grpc.code"], kind)
+		assert.Equal(t, "1", log["grpc.request_count"], kind)
+		assert.Equal(t, "1", log["grpc.response_count"], kind)
+	}
+
+	// Client streams end after the single response
+	collect, err := conn.NewStream(context.Background(), &grpc.StreamDesc{StreamName: "Collect", ClientStreams: true}, "/test.Collector/Collect")
+	assert.Nil(t, err)
+	assert.Nil(t, collect.SendMsg(&healthpb.HealthCheckRequest{Service: "a"}))
+	assert.Nil(t, collect.SendMsg(&healthpb.HealthCheckRequest{Service: "b"}))
+	assert.Nil(t, collect.CloseSend())
+	collected := new(healthpb.HealthCheckResponse)
+	assert.Nil(t, collect.RecvMsg(collected))
+	streamLogs = make(map[string]map[string]string)
+	for i := 0; i < 2; i++ {
+		log := receive()
+		streamLogs[log["grpc.kind"]] = log
+	}
+	for _, kind := range []string{"client stream", "server stream"} {
+		log := streamLogs[kind]
+		assert.Equal(t, "Collect", log["grpc.method"], kind)
+		assert.Equal(t, "OK", log["grpc.code"], kind)
+		assert.Equal(t, "2", log["grpc.request_count"], kind)
+		assert.Equal(t, "1", log["grpc.response_count"], kind)
+	}
+
+	// Streams abandoned without another Recv are logged once ctx is done
+	ctx, cancel = context.WithCancel(context.Background())
+	stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "test"})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Nil(t, err)
+	cancel()
+	streamLogs = make(map[string]map[string]string)
+	for i := 0; i < 2; i++ {
+		log := receive()
+		streamLogs[log["grpc.kind"]] = log
+	}
+	assert.Equal(t, "Canceled", streamLogs["client stream"]["grpc.code"])
+	assert.Equal(t, "1", streamLogs["client stream"]["grpc.response_count"])
+}
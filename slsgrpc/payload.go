@@ -0,0 +1,60 @@
+package slsgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Replacement of redacted payload fields
+const Redacted = "[REDACTED]"
+
+// payload formats a message as json with redacted fields, capped to maxPayloadSize
+func (o *options) payload(msg interface{}) string {
+	var data []byte
+	var err error
+	if message, ok := msg.(proto.Message); ok {
+		data, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	} else {
+		data, err = json.Marshal(msg)
+	}
+	if err != nil {
+		data = []byte(fmt.Sprintf("%+v", msg))
+	} else if len(o.redactedFields) > 0 {
+		var v interface{}
+		if json.Unmarshal(data, &v) == nil {
+			if redacted, err := json.Marshal(o.redact(v)); err == nil {
+				data = redacted
+			}
+		}
+	}
+	if len(data) <= o.maxPayloadSize {
+		return string(data)
+	}
+	n := o.maxPayloadSize
+	for n > 0 && !utf8.RuneStart(data[n]) {
+		n--
+	}
+	return string(data[:n]) + "...(truncated)"
+}
+
+func (o *options) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if o.redactedFields[k] {
+				v[k] = Redacted
+			} else {
+				v[k] = o.redact(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = o.redact(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,27 @@
+// Package slsotel extracts opentelemetry span contexts into sls trace contents
+package slsotel
+
+import (
+	"context"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceExtractor extracts the opentelemetry span context stored in ctx
+func TraceExtractor(ctx context.Context) (hook.TraceContext, bool) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return hook.TraceContext{}, false
+	}
+	return hook.TraceContext{
+		TraceID:    spanContext.TraceID().String(),
+		SpanID:     spanContext.SpanID().String(),
+		TraceFlags: spanContext.TraceFlags().String(),
+	}, true
+}
+
+// WithTraceExtractors extracts opentelemetry span contexts, then w3c traceparent values
+func WithTraceExtractors() hook.Option {
+	return hook.WithTraceExtractors(TraceExtractor, hook.TraceparentExtractor)
+}
@@ -0,0 +1,40 @@
+package slsotel_test
+
+import (
+	"context"
+	"testing"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slsotel"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceExtractor(t *testing.T) {
+	ctx := context.Background()
+	_, ok := slsotel.TraceExtractor(ctx)
+	assert.False(t, ok)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	otelCtx := trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	traceContext, ok := slsotel.TraceExtractor(otelCtx)
+	assert.True(t, ok)
+	assert.Equal(t, hook.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", TraceFlags: "01"}, traceContext)
+
+	recorder, err := slstest.NewRecorder(slsotel.WithTraceExtractors())
+	assert.Nil(t, err)
+	logger := logrus.New()
+	logger.AddHook(recorder.Hook())
+	logger.SetFormatter(&hook.NoopFormatter{})
+	logger.WithContext(otelCtx).Info("Traced")
+	logger.WithContext(hook.ContextWithTraceparent(ctx, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")).Info("Traced by w3c")
+	recorder.AssertLogged(t, slstest.Message("Traced"), slstest.Field(hook.TraceIDKey, "4bf92f3577b34da6a3ce929d0e0e4736"))
+	recorder.AssertLogged(t, slstest.Message("Traced by w3c"), slstest.Field(hook.TraceIDKey, "0af7651916cd43dd8448eb211c80319c"))
+}
@@ -0,0 +1,65 @@
+package slstest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+)
+
+// DecodeLogGroup reads the log group posted by req, decompressing the body by
+// the x-log-compresstype header.
+func DecodeLogGroup(req *http.Request) (*hook.LogGroup, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read request body")
+	}
+	if compression := req.Header.Get(hook.HeaderLogCompressType); len(compression) > 0 {
+		rawSize, err := strconv.Atoi(req.Header.Get(hook.HeaderLogBodyRawSize))
+		if err != nil || rawSize < 0 {
+			return nil, errors.Errorf("Invalid %s %q", hook.HeaderLogBodyRawSize, req.Header.Get(hook.HeaderLogBodyRawSize))
+		}
+		if body, err = decompress(hook.Compression(compression), body, rawSize); err != nil {
+			return nil, err
+		}
+	}
+	group := new(hook.LogGroup)
+	if err := group.Unmarshal(body); err != nil {
+		return nil, errors.Wrap(err, "Unable to decode log group")
+	}
+	return group, nil
+}
+
+func decompress(compression hook.Compression, body []byte, rawSize int) ([]byte, error) {
+	switch compression {
+	case hook.CompressLZ4:
+		raw := make([]byte, rawSize)
+		n, err := lz4.UncompressBlock(body, raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to decompress lz4 body")
+		}
+		if n != rawSize {
+			return nil, errors.Errorf("Decompressed %d bytes, expected %d", n, rawSize)
+		}
+		return raw, nil
+	case hook.CompressDeflate:
+		reader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to decompress deflate body")
+		}
+		raw, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to decompress deflate body")
+		}
+		if len(raw) != rawSize {
+			return nil, errors.Errorf("Decompressed %d bytes, expected %d", len(raw), rawSize)
+		}
+		return raw, nil
+	}
+	return nil, errors.Errorf("Unknown sls compression %q", compression)
+}
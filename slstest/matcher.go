@@ -0,0 +1,120 @@
+package slstest
+
+import (
+	"fmt"
+	"strings"
+
+	hook "github.com/innopals/sls-logrus-hook"
+)
+
+// Matcher matches a received log
+type Matcher interface {
+	Match(log *hook.Log) bool
+	String() string
+}
+
+type matcher struct {
+	description string
+	match       func(log *hook.Log) bool
+}
+
+func (m matcher) Match(log *hook.Log) bool {
+	return m.match(log)
+}
+
+func (m matcher) String() string {
+	return m.description
+}
+
+// Value returns the value of a log content by key
+func Value(log *hook.Log, key string) (string, bool) {
+	for _, content := range log.Contents {
+		if content.GetKey() == key {
+			return content.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+// Fields returns the contents of a log by key
+func Fields(log *hook.Log) map[string]string {
+	fields := make(map[string]string, len(log.Contents))
+	for _, content := range log.Contents {
+		fields[content.GetKey()] = content.GetValue()
+	}
+	return fields
+}
+
+// Level matches logs of level, case insensitive, e.g. "error" or "WARNING"
+func Level(level string) Matcher {
+	return matcher{fmt.Sprintf("level=%s", level), func(log *hook.Log) bool {
+		value, ok := Value(log, "level")
+		return ok && strings.EqualFold(value, level)
+	}}
+}
+
+// Message matches logs with exactly message
+func Message(message string) Matcher {
+	return Field("message", message)
+}
+
+// MessageContains matches logs with a message containing substr
+func MessageContains(substr string) Matcher {
+	return matcher{fmt.Sprintf("message~%q", substr), func(log *hook.Log) bool {
+		value, ok := Value(log, "message")
+		return ok && strings.Contains(value, substr)
+	}}
+}
+
+// Field matches logs with a content of key & value
+func Field(key string, value string) Matcher {
+	return matcher{fmt.Sprintf("%s=%q", key, value), func(log *hook.Log) bool {
+		actual, ok := Value(log, key)
+		return ok && actual == value
+	}}
+}
+
+// HasField matches logs with a content of key
+func HasField(key string) Matcher {
+	return matcher{fmt.Sprintf("has %s", key), func(log *hook.Log) bool {
+		_, ok := Value(log, key)
+		return ok
+	}}
+}
+
+// Not matches logs not matched by m
+func Not(m Matcher) Matcher {
+	return matcher{fmt.Sprintf("not %s", m), func(log *hook.Log) bool {
+		return !m.Match(log)
+	}}
+}
+
+func matchAll(log *hook.Log, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.Match(log) {
+			return false
+		}
+	}
+	return true
+}
+
+func find(logs []*hook.Log, matchers []Matcher) []*hook.Log {
+	var found []*hook.Log
+	for _, log := range logs {
+		if matchAll(log, matchers) {
+			found = append(found, log)
+		}
+	}
+	return found
+}
+
+func describe(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return "{}"
+	}
+	descriptions := make([]string, len(matchers))
+	for i, m := range matchers {
+		descriptions[i] = m.String()
+	}
+	return "{" + strings.Join(descriptions, ", ") + "}"
+}
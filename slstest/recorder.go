@@ -0,0 +1,168 @@
+// Package slstest provides helpers for testing code logging to sls, without
+// network access to a real sls endpoint.
+package slstest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+)
+
+// DefaultFlushTimeout bounds the flush of logs before they are read from a recorder
+const DefaultFlushTimeout = 5 * time.Second
+
+// Recorder captures logs sent through a real producer. It serves as the
+// http.RoundTripper of the producer, so logs are encoded, compressed & decoded
+// as they would be by sls, and no request leaves the process.
+type Recorder struct {
+	producer *hook.Producer
+	lock     sync.Mutex
+	groups   []*hook.LogGroup
+}
+
+// NewRecorder creates a recorder with a producer configured by opts on top of
+// test credentials & a short send interval. opts should not set the http
+// client or transport.
+func NewRecorder(opts ...hook.Option) (*Recorder, error) {
+	recorder := &Recorder{}
+	defaults := []hook.Option{
+		hook.WithEndpoint("http://slstest.invalid"),
+		hook.WithCredentials("test", "test"),
+		hook.WithLogStore("test"),
+		hook.WithTopic("test"),
+		hook.WithSendInterval(10 * time.Millisecond),
+	}
+	producer, err := hook.NewProducer(append(append(defaults, opts...), hook.WithTransport(recorder))...)
+	if err != nil {
+		return nil, err
+	}
+	recorder.producer = producer
+	return recorder, nil
+}
+
+// Producer returns the producer sending logs to the recorder
+func (r *Recorder) Producer() *hook.Producer {
+	return r.producer
+}
+
+// Hook returns a logrus hook sending logs of every level to the recorder
+func (r *Recorder) Hook() *hook.SlsLogrusHook {
+	return hook.NewHookWithProducer(r.producer)
+}
+
+// RoundTrip records posted log groups & answers every request with success
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPost {
+		group, err := DecodeLogGroup(req)
+		if err != nil {
+			return nil, err
+		}
+		r.lock.Lock()
+		r.groups = append(r.groups, group)
+		r.lock.Unlock()
+	}
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	header := make(http.Header)
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func (r *Recorder) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultFlushTimeout)
+	defer cancel()
+	_ = r.producer.FlushContext(ctx)
+}
+
+// Groups flushes queued logs & returns the log groups received so far
+func (r *Recorder) Groups() []*hook.LogGroup {
+	r.flush()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*hook.LogGroup{}, r.groups...)
+}
+
+// Logs flushes queued logs & returns the logs received so far in order. Logs are
+// decoded from requests, so they stay valid after the producer reuses its own.
+func (r *Recorder) Logs() []*hook.Log {
+	var logs []*hook.Log
+	for _, group := range r.Groups() {
+		logs = append(logs, group.Logs...)
+	}
+	return logs
+}
+
+// Find returns the received logs matching every matcher
+func (r *Recorder) Find(matchers ...Matcher) []*hook.Log {
+	return find(r.Logs(), matchers)
+}
+
+// Reset flushes queued logs & forgets the logs received so far
+func (r *Recorder) Reset() {
+	r.flush()
+	r.lock.Lock()
+	r.groups = nil
+	r.lock.Unlock()
+}
+
+// TestingT is the part of testing.TB used by assertions
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// AssertLogged asserts that a received log matches every matcher, returning the first one
+func (r *Recorder) AssertLogged(t TestingT, matchers ...Matcher) *hook.Log {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	logs := r.Logs()
+	for _, log := range logs {
+		if matchAll(log, matchers) {
+			return log
+		}
+	}
+	t.Errorf("No log matches %s among %d logs:%s", describe(matchers), len(logs), dump(logs))
+	return nil
+}
+
+// AssertNotLogged asserts that no received log matches every matcher
+func (r *Recorder) AssertNotLogged(t TestingT, matchers ...Matcher) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	if found := r.Find(matchers...); len(found) > 0 {
+		t.Errorf("%d logs match %s:%s", len(found), describe(matchers), dump(found))
+		return false
+	}
+	return true
+}
+
+func dump(logs []*hook.Log) string {
+	var b strings.Builder
+	for _, log := range logs {
+		b.WriteString("\n\t")
+		for i, content := range log.Contents {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "%s=%q", content.GetKey(), content.GetValue())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package slstest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	recorder, err := slstest.NewRecorder(hook.WithCompression(hook.CompressLZ4))
+	assert.Nil(t, err)
+	logger := logrus.New()
+	logger.AddHook(recorder.Hook())
+	logger.SetFormatter(&hook.NoopFormatter{})
+	logger.SetOutput(ioutil.Discard)
+	logger.SetLevel(logrus.DebugLevel)
+
+	logger.WithField("user", "alice").Info("signed in")
+	logger.WithError(errors.New("timeout")).Error(strings.Repeat("payment failed ", 10))
+	logger.Debug("cache miss")
+
+	log := recorder.AssertLogged(t, slstest.Level("info"), slstest.Message("signed in"), slstest.Field("user", "alice"))
+	assert.Equal(t, "alice", slstest.Fields(log)["user"])
+	recorder.AssertLogged(t, slstest.Level("ERROR"), slstest.MessageContains("payment failed"), slstest.Field("error.message", "timeout"))
+	recorder.AssertNotLogged(t, slstest.Level("warning"))
+	assert.Equal(t, 2, len(recorder.Find(slstest.Not(slstest.Level("error")))))
+	assert.Equal(t, 1, len(recorder.Find(slstest.HasField("error.message"))))
+	assert.Equal(t, 3, len(recorder.Logs()))
+
+	// Logs stay valid while the producer reuses its own
+	logger.Info("another")
+	assert.Equal(t, "signed in", slstest.Fields(log)["message"])
+
+	recorder.Reset()
+	assert.Equal(t, 0, len(recorder.Logs()))
+}
+
+func TestRecorderAssertions(t *testing.T) {
+	recorder, err := slstest.NewRecorder()
+	assert.Nil(t, err)
+	assert.Nil(t, recorder.Producer().SendMap(time.Now(), map[string]string{"level": "WARNING", "message": "disk full"}))
+
+	failed := &fakeT{}
+	assert.Nil(t, recorder.AssertLogged(failed, slstest.Level("error"), slstest.Message("disk full")))
+	assert.False(t, recorder.AssertNotLogged(failed, slstest.MessageContains("disk")))
+	assert.Equal(t, []string{
+		"No log matches {level=error, message=\"disk full\"} among 1 logs:\n\tlevel=\"WARNING\" message=\"disk full\"",
+		"1 logs match {message~\"disk\"}:\n\tlevel=\"WARNING\" message=\"disk full\"",
+	}, failed.errors)
+}
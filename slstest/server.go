@@ -0,0 +1,330 @@
+package slstest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+)
+
+// DefaultMaxClockSkew is the difference between request dates & the server clock
+// accepted by a server, as sls does
+const DefaultMaxClockSkew = 15 * time.Minute
+
+// Fault is injected into log posts of a server. The latency is waited first,
+// then the connection is dropped, or an error is returned if Status is set.
+type Fault struct {
+	Latency time.Duration
+	Drop    bool
+	Status  int
+	Code    string
+	Message string
+}
+
+// Latency delays the response
+func Latency(latency time.Duration) Fault {
+	return Fault{Latency: latency}
+}
+
+// InternalError fails with a retryable 500 error
+func InternalError() Fault {
+	return Fault{Status: http.StatusInternalServerError, Code: "InternalServerError", Message: "Injected internal server error"}
+}
+
+// QuotaExceeded fails with a retryable write quota error
+func QuotaExceeded() Fault {
+	return Fault{Status: http.StatusForbidden, Code: "WriteQuotaExceed", Message: "Injected write quota exceeded"}
+}
+
+// Unauthorized fails as if the signature did not match
+func Unauthorized() Fault {
+	return Fault{Status: http.StatusUnauthorized, Code: "SignatureNotMatch", Message: "Injected signature mismatch"}
+}
+
+// DropConnection closes the connection without a response
+func DropConnection() Fault {
+	return Fault{Drop: true}
+}
+
+// Received is a log group received by a server
+type Received struct {
+	LogStore string
+	// HashKey is set for groups posted to the hash route, empty for load balanced groups
+	HashKey     string
+	Compression hook.Compression
+	Group       *hook.LogGroup
+	Time        time.Time
+}
+
+type injected struct {
+	fault Fault
+	// times left, negative until cleared
+	times int
+}
+
+// Server is a local sls compatible http server for integration tests & local
+// development. It verifies signatures, stores log groups posted to
+// /logstores/{logstore}/shards/lb & /logstores/{logstore}/shards/route?key={hash}
+// and injects faults into log posts.
+type Server struct {
+	URL          string
+	AccessKey    string
+	AccessSecret string
+	// MaxClockSkew of request dates, RequestTimeExpired is returned beyond it
+	MaxClockSkew time.Duration
+	// ClockSkew puts the server clock ahead of the local clock, e.g. to test the
+	// clock offset correction of clients
+	ClockSkew time.Duration
+
+	server    *httptest.Server
+	lock      sync.Mutex
+	received  []Received
+	faults    []injected
+	requestID int
+	notify    chan struct{}
+}
+
+// NewServer starts a server accepting requests signed by accessKey & accessSecret
+func NewServer(accessKey string, accessSecret string) *Server {
+	s := &Server{
+		AccessKey:    accessKey,
+		AccessSecret: accessSecret,
+		MaxClockSkew: DefaultMaxClockSkew,
+		notify:       make(chan struct{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+// Options returns the endpoint & credentials of the server, to be followed by
+// log store & topic options
+func (s *Server) Options() []hook.Option {
+	return []hook.Option{
+		hook.WithEndpoint(s.URL),
+		hook.WithCredentials(s.AccessKey, s.AccessSecret),
+	}
+}
+
+// Inject injects fault into the next times log posts, or every log post until
+// ClearFaults if times is not positive. Faults are injected in order.
+func (s *Server) Inject(fault Fault, times int) {
+	if times <= 0 {
+		times = -1
+	}
+	s.lock.Lock()
+	s.faults = append(s.faults, injected{fault, times})
+	s.lock.Unlock()
+}
+
+// ClearFaults removes injected faults
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	s.faults = nil
+	s.lock.Unlock()
+}
+
+// nextFault takes the fault injected into the next log post
+func (s *Server) nextFault() (Fault, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.faults) == 0 {
+		return Fault{}, false
+	}
+	next := &s.faults[0]
+	fault := next.fault
+	if next.times > 0 {
+		next.times--
+		if next.times == 0 {
+			s.faults = s.faults[1:]
+		}
+	}
+	return fault, true
+}
+
+// Received returns the log groups received so far in order
+func (s *Server) Received() []Received {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Received{}, s.received...)
+}
+
+// Logs returns the logs received so far in order
+func (s *Server) Logs() []*hook.Log {
+	var logs []*hook.Log
+	for _, received := range s.Received() {
+		logs = append(logs, received.Group.Logs...)
+	}
+	return logs
+}
+
+// Find returns the received logs matching every matcher
+func (s *Server) Find(matchers ...Matcher) []*hook.Log {
+	return find(s.Logs(), matchers)
+}
+
+// Wait waits up to timeout until count received logs match every matcher,
+// returning the logs matched when done.
+func (s *Server) Wait(timeout time.Duration, count int, matchers ...Matcher) []*hook.Log {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.lock.Lock()
+		notify := s.notify
+		s.lock.Unlock()
+		found := s.Find(matchers...)
+		if len(found) >= count {
+			return found
+		}
+		select {
+		case <-notify:
+		case <-deadline.C:
+			return found
+		}
+	}
+}
+
+// Reset forgets the log groups received so far
+func (s *Server) Reset() {
+	s.lock.Lock()
+	s.received = nil
+	s.lock.Unlock()
+}
+
+func (s *Server) serveHTTP(writer http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	s.requestID++
+	writer.Header().Set(hook.HeaderLogRequestID, fmt.Sprintf("slstest-%d", s.requestID))
+	s.lock.Unlock()
+	writer.Header().Set(hook.HeaderDate, s.now().UTC().Format(http.TimeFormat))
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "InvalidParameter", err.Error())
+		return
+	}
+	if status, code, message := s.authenticate(req, body); status != http.StatusOK {
+		writeError(writer, status, code, message)
+		return
+	}
+	path := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.Method == http.MethodGet && len(path) == 2 && path[0] == "logstores":
+		writer.Header().Set(hook.HeaderContentType, "application/json")
+		_ = json.NewEncoder(writer).Encode(map[string]string{"logstoreName": path[1]})
+	case req.Method == http.MethodPost && len(path) == 4 && path[0] == "logstores" && path[2] == "shards" &&
+		(path[3] == "lb" || path[3] == "route" && len(req.URL.Query().Get("key")) > 0):
+		s.postLogs(writer, req, path[1], body)
+	default:
+		writeError(writer, http.StatusNotFound, "NotFound", fmt.Sprintf("No route for %s %s", req.Method, req.URL.Path))
+	}
+}
+
+// authenticate verifies the signature, body md5 & date of a request
+func (s *Server) authenticate(req *http.Request, body []byte) (int, string, string) {
+	headers := make(map[string]string)
+	for key := range req.Header {
+		name := strings.ToLower(key)
+		if strings.HasPrefix(name, "x-log") || strings.HasPrefix(name, "x-acs") {
+			headers[name] = req.Header.Get(key)
+		}
+	}
+	for _, key := range []string{hook.HeaderContentMd5, hook.HeaderContentType, hook.HeaderDate} {
+		if value := req.Header.Get(key); len(value) > 0 {
+			headers[key] = value
+		}
+	}
+	sign := hook.APISign(s.AccessSecret, req.Method, headers, resource(req))
+	if req.Header.Get(hook.HeaderAuthorization) != fmt.Sprintf("LOG %s:%s", s.AccessKey, sign) {
+		return http.StatusUnauthorized, "SignatureNotMatch", "Signature of the request does not match"
+	}
+	if contentMD5 := req.Header.Get(hook.HeaderContentMd5); len(contentMD5) > 0 &&
+		contentMD5 != strings.ToUpper(fmt.Sprintf("%x", md5.Sum(body))) {
+		return http.StatusBadRequest, "InvalidContentMD5", "Content-MD5 does not match the body"
+	}
+	date, err := http.ParseTime(req.Header.Get(hook.HeaderDate))
+	if err != nil {
+		return http.StatusBadRequest, "InvalidDateFormat", "Invalid date header"
+	}
+	if skew := s.now().Sub(date); skew > s.MaxClockSkew || skew < -s.MaxClockSkew {
+		return http.StatusBadRequest, "RequestTimeExpired", "Request date is too far from the server time"
+	}
+	return http.StatusOK, "", ""
+}
+
+// resource is the signed path & sorted query of a request
+func resource(req *http.Request) string {
+	query := req.URL.Query()
+	if len(query) == 0 {
+		return req.URL.Path
+	}
+	params := make([]string, 0, len(query))
+	for key := range query {
+		params = append(params, key+"="+query.Get(key))
+	}
+	sort.Strings(params)
+	return req.URL.Path + "?" + strings.Join(params, "&")
+}
+
+func (s *Server) postLogs(writer http.ResponseWriter, req *http.Request, logStore string, body []byte) {
+	if fault, ok := s.nextFault(); ok {
+		time.Sleep(fault.Latency)
+		if fault.Drop {
+			if hijacker, ok := writer.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					_ = conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if fault.Status != 0 {
+			writeError(writer, fault.Status, fault.Code, fault.Message)
+			return
+		}
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	group, err := DecodeLogGroup(req)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "PostBodyInvalid", err.Error())
+		return
+	}
+	s.lock.Lock()
+	s.received = append(s.received, Received{
+		LogStore:    logStore,
+		HashKey:     req.URL.Query().Get("key"),
+		Compression: hook.Compression(req.Header.Get(hook.HeaderLogCompressType)),
+		Group:       group,
+		Time:        time.Now(),
+	})
+	close(s.notify)
+	s.notify = make(chan struct{})
+	s.lock.Unlock()
+	writer.WriteHeader(http.StatusOK)
+}
+
+// now is the time of the server clock
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.ClockSkew)
+}
+
+func writeError(writer http.ResponseWriter, status int, code string, message string) {
+	writer.Header().Set(hook.HeaderContentType, "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(map[string]string{"errorCode": code, "errorMessage": message})
+}
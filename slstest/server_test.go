@@ -0,0 +1,164 @@
+package slstest_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T, server *slstest.Server, config hook.Config) *hook.SlsClient {
+	config.Endpoint = server.URL
+	config.AccessKey = "test"
+	config.LogStore = "app"
+	config.Topic = "test"
+	config.Timeout = hook.DefaultTimeout
+	if len(config.AccessSecret) == 0 {
+		config.AccessSecret = "test"
+	}
+	client, err := hook.NewSlsClient(&config)
+	assert.Nil(t, err)
+	return client
+}
+
+func testLog(message string) *hook.Log {
+	return &hook.Log{
+		Time: proto.Uint32(uint32(time.Now().Unix())),
+		Contents: []*hook.LogContent{
+			{Key: proto.String("level"), Value: proto.String("INFO")},
+			{Key: proto.String("message"), Value: proto.String(message)},
+		},
+	}
+}
+
+func apiErrorCode(err error) string {
+	if apiError, ok := errors.Cause(err).(*hook.APIError); ok {
+		return apiError.Code
+	}
+	return ""
+}
+
+func TestServer(t *testing.T) {
+	server := slstest.NewServer("test", "test")
+	defer server.Close()
+	producer, err := hook.NewProducer(append(server.Options(),
+		hook.WithLogStore("app"),
+		hook.WithTopic("test"),
+		hook.WithCompression(hook.CompressLZ4),
+		hook.WithSendInterval(10*time.Millisecond),
+	)...)
+	assert.Nil(t, err)
+	assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"level": "ERROR", "message": strings.Repeat("failed ", 10)}))
+	assert.Nil(t, producer.SendMap(time.Now(), map[string]string{"level": "INFO", "message": "done"}))
+
+	found := server.Wait(time.Second, 1, slstest.Level("error"), slstest.MessageContains("failed"))
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, 2, len(server.Wait(time.Second, 2)))
+	received := server.Received()
+	assert.Equal(t, "app", received[0].LogStore)
+	assert.Equal(t, "", received[0].HashKey)
+	assert.Equal(t, hook.CompressLZ4, received[0].Compression)
+	assert.Equal(t, "test", received[0].Group.GetTopic())
+	assert.Equal(t, 1, len(server.Find(slstest.Message("done"))))
+
+	server.Reset()
+	assert.Equal(t, 0, len(server.Logs()))
+}
+
+func TestServerDeflate(t *testing.T) {
+	server := slstest.NewServer("test", "test")
+	defer server.Close()
+	client := newClient(t, server, hook.Config{Compression: hook.CompressDeflate})
+	assert.Nil(t, client.SendLogs([]*hook.Log{testLog(strings.Repeat("deflated ", 10))}))
+	assert.Equal(t, hook.CompressDeflate, server.Received()[0].Compression)
+	assert.Equal(t, 1, len(server.Find(slstest.MessageContains("deflated"))))
+}
+
+func TestServerHashRoute(t *testing.T) {
+	server := slstest.NewServer("test", "test")
+	defer server.Close()
+	body, err := (&hook.LogGroup{Logs: []*hook.Log{testLog("hashed")}}).Marshal()
+	assert.Nil(t, err)
+	resource := "/logstores/app/shards/route?key=0f"
+	headers := map[string]string{
+		hook.HeaderLogVersion:         hook.SlsVersion,
+		hook.HeaderLogSignatureMethod: hook.SlsSignatureMethod,
+		hook.HeaderLogBodyRawSize:     fmt.Sprint(len(body)),
+		hook.HeaderContentType:        "application/x-protobuf",
+		hook.HeaderContentMd5:         strings.ToUpper(fmt.Sprintf("%x", md5.Sum(body))),
+		hook.HeaderDate:               time.Now().UTC().Format(http.TimeFormat),
+	}
+	req, err := http.NewRequest("POST", server.URL+resource, bytes.NewReader(body))
+	assert.Nil(t, err)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(hook.HeaderAuthorization, "LOG test:"+hook.APISign("test", "POST", headers, resource))
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "0f", server.Received()[0].HashKey)
+
+	// Tampered bodies are rejected
+	req, err = http.NewRequest("POST", server.URL+resource, bytes.NewReader(append(body, 0)))
+	assert.Nil(t, err)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(hook.HeaderAuthorization, "LOG test:"+hook.APISign("test", "POST", headers, resource))
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestServerSignature(t *testing.T) {
+	server := slstest.NewServer("test", "test")
+	defer server.Close()
+	client := newClient(t, server, hook.Config{AccessSecret: "wrong", MaxRetries: -1})
+	assert.Equal(t, "SignatureNotMatch", apiErrorCode(client.Ping()))
+	assert.Equal(t, "SignatureNotMatch", apiErrorCode(client.SendLogs([]*hook.Log{testLog("unsigned")})))
+	assert.Equal(t, 0, len(server.Logs()))
+}
+
+func TestServerFaults(t *testing.T) {
+	server := slstest.NewServer("test", "test")
+	defer server.Close()
+	client := newClient(t, server, hook.Config{MaxRetries: -1})
+
+	server.Inject(slstest.InternalError(), 1)
+	server.Inject(slstest.QuotaExceeded(), 1)
+	server.Inject(slstest.Unauthorized(), 1)
+	server.Inject(slstest.DropConnection(), 1)
+	assert.Nil(t, client.Ping())
+	assert.Equal(t, "InternalServerError", apiErrorCode(client.SendLogs([]*hook.Log{testLog("failed")})))
+	assert.Equal(t, "WriteQuotaExceed", apiErrorCode(client.SendLogs([]*hook.Log{testLog("failed")})))
+	assert.Equal(t, "SignatureNotMatch", apiErrorCode(client.SendLogs([]*hook.Log{testLog("failed")})))
+	err := client.SendLogs([]*hook.Log{testLog("failed")})
+	assert.NotNil(t, err)
+	assert.Equal(t, "", apiErrorCode(err))
+	assert.Equal(t, 0, len(server.Logs()))
+
+	server.Inject(slstest.Latency(50*time.Millisecond), 0)
+	start := time.Now()
+	assert.Nil(t, client.SendLogs([]*hook.Log{testLog("slow")}))
+	assert.Nil(t, client.SendLogs([]*hook.Log{testLog("slow")}))
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	server.ClearFaults()
+	assert.Nil(t, client.SendLogs([]*hook.Log{testLog("fast")}))
+	assert.Equal(t, 3, len(server.Logs()))
+
+	// Retried after a failure
+	retrying := newClient(t, server, hook.Config{})
+	server.Inject(slstest.InternalError(), 1)
+	assert.Nil(t, retrying.SendLogs([]*hook.Log{testLog("retried")}))
+	assert.Equal(t, 1, len(server.Find(slstest.Message("retried"))))
+}
@@ -0,0 +1,163 @@
+// Package slszap provides a zap core sending entries to sls through a producer
+package slszap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/innopals/sls-logrus-hook/internal/field"
+	"go.uber.org/zap/zapcore"
+)
+
+// Core implements zapcore.Core, sending entries through a producer
+type Core struct {
+	zapcore.LevelEnabler
+	producer *hook.Producer
+	// contents preformatted from With
+	contents []*hook.LogContent
+}
+
+// NewCore creates a zapcore.Core sending entries through the producer, which
+// may be shared with a logrus hook by hook.Producer()
+func NewCore(producer *hook.Producer, enabler zapcore.LevelEnabler) *Core {
+	return &Core{
+		LevelEnabler: enabler,
+		producer:     producer,
+	}
+}
+
+// With implements zapcore.Core
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	if len(fields) == 0 {
+		return c
+	}
+	// Encode fields once into a scratch log, they are copied into every entry
+	scratch := &hook.Log{}
+	appendZapFields(scratch, fields)
+	core := *c
+	core.contents = make([]*hook.LogContent, 0, len(c.contents)+len(scratch.Contents))
+	core.contents = append(core.contents, c.contents...)
+	core.contents = append(core.contents, scratch.Contents...)
+	return &core
+}
+
+// Check implements zapcore.Core
+func (c *Core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write implements zapcore.Core
+func (c *Core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	t := entry.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	log := &hook.Log{Time: new(uint32)}
+	*log.Time = uint32(t.Unix())
+	appendContent(log, "level", zapLevelName(entry.Level))
+	if entry.Caller.Defined {
+		appendContent(log, "location", entry.Caller.File+"#"+strconv.Itoa(entry.Caller.Line))
+	}
+	appendContent(log, "message", entry.Message)
+	if len(entry.LoggerName) > 0 {
+		appendContent(log, "logger", entry.LoggerName)
+	}
+	if len(entry.Stack) > 0 {
+		appendContent(log, "stack", entry.Stack)
+	}
+	log.Contents = append(log.Contents, c.contents...)
+	appendZapFields(log, fields)
+	if entry.Level == zapcore.PanicLevel || entry.Level == zapcore.FatalLevel {
+		// zap exits or panics right after writing, DPanic only does in development
+		return c.producer.SendFatal(context.Background(), log)
+	}
+	return c.producer.Send(log)
+}
+
+// Sync implements zapcore.Core, flushing queued logs through sls api
+func (c *Core) Sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.DefaultTimeout)
+	defer cancel()
+	return c.producer.FlushContext(ctx)
+}
+
+func appendZapFields(log *hook.Log, fields []zapcore.Field) {
+	if len(fields) == 0 {
+		return
+	}
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+	appendZapMap(log, "", encoder.Fields)
+}
+
+// appendZapMap adds encoded fields sorted by key, namespaces & objects with dotted keys
+func appendZapMap(log *hook.Log, prefix string, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if nested, ok := fields[k].(map[string]interface{}); ok {
+			appendZapMap(log, prefix+k+".", nested)
+			continue
+		}
+		if value := formatZapValue(fields[k]); len(value) > 0 {
+			appendContent(log, field.Key(prefix+k), value)
+		}
+	}
+}
+
+func formatZapValue(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int32, int16, int8, int, uint64, uint32, uint16, uint8, uint, uintptr:
+		return fmt.Sprint(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return field.Format(v)
+	}
+}
+
+// zapLevelName names zap levels the same as logrus levels
+func zapLevelName(level zapcore.Level) string {
+	switch level {
+	case zapcore.DebugLevel:
+		return "DEBUG"
+	case zapcore.InfoLevel:
+		return "INFO"
+	case zapcore.WarnLevel:
+		return "WARNING"
+	case zapcore.ErrorLevel, zapcore.DPanicLevel:
+		return "ERROR"
+	case zapcore.PanicLevel:
+		return "PANIC"
+	case zapcore.FatalLevel:
+		return "FATAL"
+	default:
+		return level.CapitalString()
+	}
+}
+
+func appendContent(log *hook.Log, key string, value string) {
+	log.Contents = append(log.Contents, &hook.LogContent{Key: &key, Value: &value})
+}
@@ -0,0 +1,46 @@
+package slszap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/innopals/sls-logrus-hook/slstest"
+	"github.com/innopals/sls-logrus-hook/slszap"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCore(t *testing.T) {
+	recorder, err := slstest.NewRecorder()
+	assert.Nil(t, err)
+
+	core := slszap.NewCore(recorder.Producer(), zapcore.InfoLevel)
+	logger := zap.New(core, zap.AddCaller()).Named("test")
+	logger.Debug("Ignored")
+	logger.With(zap.String("service", "test")).Warn("Hello zap!",
+		zap.Int("count", 3),
+		zap.Duration("elapsed", 1500*time.Millisecond),
+		zap.Strings("tags", []string{"a", "b"}),
+		zap.Namespace("request"),
+		zap.Int("id", 42),
+		zap.String("message", "nested"),
+	)
+	assert.Nil(t, logger.Sync())
+
+	logs := recorder.Logs()
+	assert.Equal(t, 1, len(logs))
+	log := logs[0]
+	contents := slstest.Fields(log)
+	assert.Equal(t, "level", log.Contents[0].GetKey())
+	assert.Equal(t, "WARNING", contents["level"])
+	assert.Contains(t, contents["location"], "core_test.go#")
+	assert.Equal(t, "Hello zap!", contents["message"])
+	assert.Equal(t, "test", contents["logger"])
+	assert.Equal(t, "test", contents["service"])
+	assert.Equal(t, "3", contents["count"])
+	assert.Equal(t, "1.5s", contents["elapsed"])
+	assert.Equal(t, `["a","b"]`, contents["tags"])
+	assert.Equal(t, "42", contents["request.id"])
+	assert.Equal(t, "nested", contents["request.message"])
+}
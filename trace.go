@@ -0,0 +1,91 @@
+package hook
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+)
+
+// Content keys for trace context, as expected by sls trace
+const (
+	TraceIDKey    = "trace_id"
+	SpanIDKey     = "span_id"
+	TraceFlagsKey = "trace_flags"
+)
+
+// TraceContext identifies the trace & span a log is emitted in
+type TraceContext struct {
+	TraceID    string
+	SpanID     string
+	TraceFlags string
+}
+
+// TraceExtractor pulls the trace context out of a logrus entry context
+type TraceExtractor func(ctx context.Context) (TraceContext, bool)
+
+// DefaultTraceExtractors are used when Config.TraceExtractors is nil. Package
+// slsotel extracts opentelemetry span contexts.
+var DefaultTraceExtractors = []TraceExtractor{TraceparentExtractor}
+
+type traceparentKey struct{}
+
+// ContextWithTraceparent stores a w3c traceparent header value in ctx
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	return context.WithValue(ctx, traceparentKey{}, traceparent)
+}
+
+// TraceparentExtractor extracts the w3c traceparent stored by ContextWithTraceparent
+func TraceparentExtractor(ctx context.Context) (TraceContext, bool) {
+	traceparent, ok := ctx.Value(traceparentKey{}).(string)
+	if !ok {
+		return TraceContext{}, false
+	}
+	return ParseTraceparent(traceparent)
+}
+
+// ParseTraceparent parses a w3c traceparent header value,
+// e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceparent(traceparent string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return TraceContext{}, false
+	}
+	traceID, spanID, flags := strings.ToLower(parts[1]), strings.ToLower(parts[2]), strings.ToLower(parts[3])
+	if !isHex(parts[0]) || len(traceID) != 32 || !isHex(traceID) || len(spanID) != 16 || !isHex(spanID) || len(flags) != 2 || !isHex(flags) {
+		return TraceContext{}, false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return TraceContext{}, false
+	}
+	return TraceContext{TraceID: traceID, SpanID: spanID, TraceFlags: flags}, true
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func extractTrace(ctx context.Context, extractors []TraceExtractor) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	for _, extractor := range extractors {
+		if traceContext, ok := extractor(ctx); ok {
+			return traceContext, true
+		}
+	}
+	return TraceContext{}, false
+}
+
+func appendTrace(log *Log, traceContext TraceContext) {
+	appendContent(log, TraceIDKey, traceContext.TraceID)
+	appendContent(log, SpanIDKey, traceContext.SpanID)
+	if len(traceContext.TraceFlags) > 0 {
+		appendContent(log, TraceFlagsKey, traceContext.TraceFlags)
+	}
+}
+
+// TraceContext extracts the trace context from ctx with the producer's extractors
+func (p *Producer) TraceContext(ctx context.Context) (TraceContext, bool) {
+	return extractTrace(ctx, p.traceExtractors)
+}
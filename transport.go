@@ -0,0 +1,83 @@
+package hook
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default config for the http transport
+const (
+	DefaultDialTimeout  = 5 * time.Second
+	DefaultKeepAlive    = 30 * time.Second
+	DefaultMaxIdleConns = 16
+)
+
+// hasTransportOptions tells whether config tunes the transport built by newHTTPClient
+func (config *Config) hasTransportOptions() bool {
+	return config.Transport != nil || len(config.ProxyURL) > 0 || config.TLSConfig != nil ||
+		config.MaxIdleConns != 0 || config.DialTimeout != 0 || config.KeepAlive != 0
+}
+
+// newHTTPClient uses config.HTTPClient or config.Transport, or builds a transport from the other options
+func newHTTPClient(config *Config) (*http.Client, error) {
+	if config.HTTPClient != nil {
+		return config.HTTPClient, nil
+	}
+	if config.Transport != nil {
+		return &http.Client{Transport: config.Transport, Timeout: config.Timeout}, nil
+	}
+	if !config.hasTransportOptions() {
+		return &http.Client{Timeout: config.Timeout}, nil
+	}
+	dialer := &net.Dialer{
+		Timeout:   orDefaultDuration(config.DialTimeout, DefaultDialTimeout),
+		KeepAlive: orDefaultDuration(config.KeepAlive, DefaultKeepAlive),
+	}
+	maxIdleConns := orDefault(config.MaxIdleConns, DefaultMaxIdleConns)
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       config.TLSConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConns,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if len(config.ProxyURL) > 0 {
+		proxyURL, err := parseProxyURL(config.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Transport: transport, Timeout: config.Timeout}, nil
+}
+
+func parseProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Invalid sls proxy url %q", proxy)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.Errorf("Invalid sls proxy url %q, scheme should be http, https or socks5", proxy)
+	}
+	if len(proxyURL.Host) == 0 {
+		return nil, errors.Errorf("Invalid sls proxy url %q, host should not be empty", proxy)
+	}
+	return proxyURL, nil
+}
+
+func orDefaultDuration(value time.Duration, defaultValue time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,49 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	var requests int32
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: "project.sls.invalid", AccessKey: "test", AccessSecret: "test", LogStore: "test", Transport: transport})
+	assert.Nil(t, err)
+	assert.Nil(t, client.Ping())
+	assert.Nil(t, client.SendLogs([]*hook.Log{hugeLog(16)}))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestProxy(t *testing.T) {
+	hosts := make(chan string, 2)
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		hosts <- req.URL.Host
+		writer.WriteHeader(200)
+	}))
+	defer proxy.Close()
+	client, err := hook.NewSlsClient(&hook.Config{Endpoint: "http://project.sls.invalid", AccessKey: "test", AccessSecret: "test", LogStore: "test", ProxyURL: proxy.URL})
+	assert.Nil(t, err)
+	assert.Nil(t, client.SendLogs([]*hook.Log{{Time: proto.Uint32(0)}}))
+	assert.Equal(t, "project.sls.invalid", <-hosts)
+
+	_, err = hook.NewSlsClient(&hook.Config{Endpoint: "project.sls.invalid", AccessKey: "test", AccessSecret: "test", LogStore: "test", ProxyURL: "ftp://proxy"})
+	assert.NotNil(t, err)
+	assert.Equal(t, `Invalid sls proxy url "ftp://proxy", scheme should be http, https or socks5`, err.Error())
+
+	_, err = hook.NewProducer(hook.WithEndpoint("project.sls.invalid"), hook.WithCredentials("test", "test"), hook.WithLogStore("test"), hook.WithTopic("test"),
+		hook.WithHTTPClient(http.DefaultClient), hook.WithMaxIdleConns(4))
+	assert.NotNil(t, err)
+	assert.Equal(t, "Invalid sls config: http client should not be set along with transport options", err.Error())
+}
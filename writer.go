@@ -0,0 +1,205 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/innopals/sls-logrus-hook/internal/field"
+)
+
+// LineFormat decides how Writer parses lines into contents
+type LineFormat int
+
+// Line formats
+const (
+	// LinePlain sends each line as message
+	LinePlain LineFormat = iota
+	// LineJSON parses json object lines, other lines are sent as message
+	LineJSON
+	// LineLogfmt parses logfmt lines, other lines are sent as message
+	LineLogfmt
+	// LineAuto parses json object or logfmt lines, other lines are sent as message
+	LineAuto
+)
+
+// Writer implements io.Writer, sending each written line as a log through a producer
+type Writer struct {
+	producer *Producer
+	format   LineFormat
+	lock     sync.Mutex
+	// partial line pending a newline
+	buf []byte
+}
+
+// Writer creates an io.Writer sharing the queue & sls client of the hook
+func (hook *SlsLogrusHook) Writer(format LineFormat) *Writer {
+	return hook.producer.Writer(format)
+}
+
+// Writer creates an io.Writer sending lines through the producer
+func (p *Producer) Writer(format LineFormat) *Writer {
+	return &Writer{producer: p, format: format}
+}
+
+// Write implements io.Writer, a trailing partial line is kept until completed or Close
+func (w *Writer) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	n := len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, b...)
+			if len(w.buf) >= MaxLogItemSize {
+				// Do not buffer endless lines
+				w.sendLine(w.buf)
+				w.buf = w.buf[:0]
+			}
+			break
+		}
+		line := b[:i]
+		if len(w.buf) > 0 {
+			line = append(w.buf, line...)
+			w.buf = w.buf[:0]
+		}
+		w.sendLine(line)
+		b = b[i+1:]
+	}
+	return n, nil
+}
+
+// Close sends the pending partial line
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.buf) > 0 {
+		w.sendLine(w.buf)
+		w.buf = w.buf[:0]
+	}
+	return nil
+}
+
+func (w *Writer) sendLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	log := acquireLog(uint32(time.Now().Unix()))
+	if !parseLine(log, line, w.format) {
+		appendContent(log, "message", string(line))
+	}
+	_ = w.producer.send(context.Background(), log)
+}
+
+func parseLine(log *Log, line []byte, format LineFormat) bool {
+	switch format {
+	case LineJSON:
+		return parseJSONLine(log, line)
+	case LineLogfmt:
+		return parseLogfmtLine(log, line)
+	case LineAuto:
+		return parseJSONLine(log, line) || parseLogfmtLine(log, line)
+	}
+	return false
+}
+
+func parseJSONLine(log *Log, line []byte) bool {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(trimmed, &fields) != nil || len(fields) == 0 {
+		return false
+	}
+	for k, v := range fields {
+		if value := field.Format(v); len(value) > 0 {
+			appendContent(log, field.SlsKey(k), value)
+		}
+	}
+	return true
+}
+
+// parseLogfmtLine parses key=value pairs, values may be double quoted.
+// The line is rejected unless every token is a pair.
+func parseLogfmtLine(log *Log, line []byte) bool {
+	type pair struct{ key, value string }
+	var pairs []pair
+	s := string(line)
+	for {
+		for len(s) > 0 && (s[0] == ' ' || s[0] == '\t') {
+			s = s[1:]
+		}
+		if len(s) == 0 {
+			break
+		}
+		eq := 0
+		for eq < len(s) && s[eq] != '=' && s[eq] != ' ' && s[eq] != '\t' && s[eq] != '"' {
+			eq++
+		}
+		if eq == 0 || eq == len(s) || s[eq] != '=' {
+			return false
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+		var value string
+		if len(s) > 0 && s[0] == '"' {
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return false
+			}
+			unquoted, err := strconv.Unquote(s[:end+1])
+			if err != nil || !utf8.ValidString(unquoted) {
+				return false
+			}
+			value = unquoted
+			s = s[end+1:]
+			if len(s) > 0 && s[0] != ' ' && s[0] != '\t' {
+				return false
+			}
+		} else {
+			end := 0
+			for end < len(s) && s[end] != ' ' && s[end] != '\t' {
+				end++
+			}
+			value = s[:end]
+			s = s[end:]
+		}
+		pairs = append(pairs, pair{key, value})
+	}
+	if len(pairs) == 0 {
+		return false
+	}
+	for _, pair := range pairs {
+		if len(pair.value) > 0 {
+			appendContent(log, field.SlsKey(pair.key), pair.value)
+		}
+	}
+	return true
+}
+
+// RedirectStdLog redirects the standard library log package into w,
+// returning a func to restore the previous output & flags.
+func RedirectStdLog(w *Writer) func() {
+	output, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(w)
+	log.SetFlags(0)
+	log.SetPrefix("")
+	return func() {
+		log.SetOutput(output)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	}
+}
@@ -0,0 +1,60 @@
+package hook_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+
+	hook "github.com/innopals/sls-logrus-hook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	writer := producer.Writer(hook.LineAuto)
+	_, err := fmt.Fprint(writer, "plain text line\n{\"level\":\"warn\",\"count\":3,")
+	assert.Nil(t, err)
+	_, err = fmt.Fprint(writer, "\"tags\":[\"a\"]}\r\nlevel=info msg=\"hello \\\"world\\\"\" ok=true\n\n")
+	assert.Nil(t, err)
+	_, err = fmt.Fprint(writer, "key=value but not logfmt")
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, producer.FlushContext(context.Background()))
+
+	logs := receiveLogs(t, server, 4)
+	// The warn log is sent first
+	assert.Equal(t, map[string]string{"level": "warn", "count": "3", "tags": `["a"]`}, logs[0])
+	assert.Equal(t, map[string]string{"message": "plain text line"}, logs[1])
+	assert.Equal(t, map[string]string{"level": "info", "msg": `hello "world"`, "ok": "true"}, logs[2])
+	assert.Equal(t, map[string]string{"message": "key=value but not logfmt"}, logs[3])
+}
+
+func TestWriterReservedKeys(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	writer := producer.Writer(hook.LineAuto)
+	_, err := fmt.Fprint(writer, "{\"__topic__\":\"evil\",\"__source__\":\"x\",\"message\":\"json\"}\n__topic__=evil message=logfmt\n")
+	assert.Nil(t, err)
+	assert.Nil(t, producer.FlushContext(context.Background()))
+
+	logs := receiveLogs(t, server, 2)
+	assert.Equal(t, map[string]string{"field___topic__": "evil", "field___source__": "x", "message": "json"}, logs[0])
+	assert.Equal(t, map[string]string{"field___topic__": "evil", "message": "logfmt"}, logs[1])
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	server := newServer(t)
+	producer := newTestProducer(t, server)
+
+	restore := hook.RedirectStdLog(producer.Writer(hook.LinePlain))
+	log.Printf("Hello %s!", "log")
+	restore()
+	assert.Nil(t, producer.FlushContext(context.Background()))
+
+	logs := receiveLogs(t, server, 1)
+	assert.Equal(t, map[string]string{"message": "Hello log!"}, logs[0])
+}